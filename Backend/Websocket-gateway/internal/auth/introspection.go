@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+
+	"github.com/yourcompany/websocket-gateway/internal/config"
+)
+
+var (
+	introspectionRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_introspection_requests_total",
+		Help: "Total number of RFC 7662 introspection requests by result",
+	}, []string{"result"})
+	introspectionCacheHits = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "auth_introspection_cache_hits_total",
+		Help: "Total number of token trust cache hits",
+	})
+	introspectionCacheMisses = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "auth_introspection_cache_misses_total",
+		Help: "Total number of token trust cache misses",
+	})
+)
+
+// introspector calls an OAuth2/OIDC introspection endpoint (RFC 7662) and
+// caches the result for cacheTTL (or negativeCacheTTL for invalid/revoked
+// tokens), so that per-message validation doesn't pay an HTTP round-trip
+// and a revoked client credential can't cause a thundering herd against
+// the introspection endpoint once its token starts failing. The cache is
+// a size-bounded LRU rather than a plain map: entries still expire on
+// their own TTL, but a token that's validated once and never looked up
+// again is eventually evicted by the LRU instead of sitting in memory
+// for the life of the process.
+type introspector struct {
+	url              string
+	clientID         string
+	clientSecret     string
+	cacheTTL         time.Duration
+	negativeCacheTTL time.Duration
+	client           *http.Client
+	logger           *zap.Logger
+
+	cache *lru.Cache
+}
+
+type cacheEntry struct {
+	active    bool
+	expiresAt time.Time
+}
+
+func newIntrospector(cfg *config.Config, logger *zap.Logger) *introspector {
+	cacheSize := cfg.Auth.TokenTrustCacheSize
+	if cacheSize <= 0 {
+		cacheSize = 10000
+	}
+	cache, err := lru.New(cacheSize)
+	if err != nil {
+		// Only returns an error for a non-positive size, which we've
+		// already guarded against above.
+		panic(fmt.Sprintf("auth: failed to create introspection cache: %v", err))
+	}
+
+	return &introspector{
+		url:              cfg.Auth.IntrospectionURL,
+		clientID:         cfg.Auth.IntrospectionClientID,
+		clientSecret:     cfg.Auth.IntrospectionClientSecret,
+		cacheTTL:         cfg.Auth.TokenTrustCacheExpiration,
+		negativeCacheTTL: cfg.Auth.TokenTrustNegativeCacheExpiration,
+		client:           &http.Client{Timeout: 5 * time.Second},
+		logger:           logger,
+		cache:            cache,
+	}
+}
+
+// check returns nil if the token is active per the introspection
+// endpoint (or a cached prior result), ErrTokenRevoked if it is inactive,
+// or a wrapped error if the introspection request itself failed.
+func (i *introspector) check(tokenString string) error {
+	key := hashToken(tokenString)
+
+	if active, ok := i.lookup(key); ok {
+		introspectionCacheHits.Inc()
+		if !active {
+			return ErrTokenRevoked
+		}
+		return nil
+	}
+	introspectionCacheMisses.Inc()
+
+	active, err := i.introspect(tokenString)
+	if err != nil {
+		introspectionRequestsTotal.WithLabelValues("error").Inc()
+		return fmt.Errorf("introspection request failed: %w", err)
+	}
+
+	i.store(key, active)
+
+	if !active {
+		introspectionRequestsTotal.WithLabelValues("inactive").Inc()
+		return ErrTokenRevoked
+	}
+	introspectionRequestsTotal.WithLabelValues("active").Inc()
+	return nil
+}
+
+func (i *introspector) lookup(key string) (active bool, ok bool) {
+	value, found := i.cache.Get(key)
+	if !found {
+		return false, false
+	}
+	entry := value.(cacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		i.cache.Remove(key)
+		return false, false
+	}
+	return entry.active, true
+}
+
+func (i *introspector) store(key string, active bool) {
+	ttl := i.cacheTTL
+	if !active {
+		ttl = i.negativeCacheTTL
+	}
+	i.cache.Add(key, cacheEntry{active: active, expiresAt: time.Now().Add(ttl)})
+}
+
+// introspectResponse is the subset of the RFC 7662 response we act on.
+type introspectResponse struct {
+	Active bool   `json:"active"`
+	Exp    int64  `json:"exp,omitempty"`
+	Scope  string `json:"scope,omitempty"`
+}
+
+func (i *introspector) introspect(tokenString string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), i.client.Timeout)
+	defer cancel()
+
+	form := url.Values{"token": {tokenString}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.url, bytes.NewBufferString(form.Encode()))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(i.clientID, i.clientSecret)
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("introspection endpoint returned %d", resp.StatusCode)
+	}
+
+	var parsed introspectResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return false, fmt.Errorf("decode introspection response: %w", err)
+	}
+
+	if parsed.Active && parsed.Exp != 0 && time.Now().Unix() >= parsed.Exp {
+		return false, nil
+	}
+
+	return parsed.Active, nil
+}
+
+func hashToken(tokenString string) string {
+	sum := sha256.Sum256([]byte(tokenString))
+	return hex.EncodeToString(sum[:])
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"strings"
 	"time"
 
@@ -18,6 +19,7 @@ var (
 	ErrExpiredToken     = errors.New("token expired")
 	ErrInvalidIssuer    = errors.New("invalid issuer")
 	ErrMissingUserID    = errors.New("missing user id")
+	ErrTokenRevoked     = errors.New("token revoked")
 )
 
 // Claims represents the JWT claims
@@ -34,20 +36,47 @@ type Authenticator struct {
 	issuer     string
 	expiry     time.Duration
 	logger     *zap.Logger
+
+	// Optional RFC 7662 introspection layered on top of the HMAC check.
+	introspection *introspector
 }
 
 // NewAuthenticator creates a new JWT authenticator
 func NewAuthenticator(cfg *config.Config, logger *zap.Logger) *Authenticator {
-	return &Authenticator{
+	a := &Authenticator{
 		secret: []byte(cfg.Auth.JWTSecret),
 		issuer: "websocket-gateway",
 		expiry: cfg.Auth.TokenExpiry,
 		logger: logger,
 	}
+
+	if cfg.Auth.IntrospectionURL != "" {
+		a.introspection = newIntrospector(cfg, logger)
+	}
+
+	return a
 }
 
-// ValidateToken validates a JWT token and returns claims
+// ValidateToken validates a JWT token and returns claims. When
+// introspection is configured, a cached or freshly-fetched RFC 7662
+// result is consulted after the signature check so that revocation is
+// observed within the trust cache window rather than only at expiry.
 func (a *Authenticator) ValidateToken(tokenString string) (*Claims, error) {
+	claims, err := a.validateSignature(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.introspection != nil {
+		if err := a.introspection.check(tokenString); err != nil {
+			return nil, err
+		}
+	}
+
+	return claims, nil
+}
+
+func (a *Authenticator) validateSignature(tokenString string) (*Claims, error) {
 	// Parse token
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		// Validate signing method
@@ -56,26 +85,26 @@ func (a *Authenticator) ValidateToken(tokenString string) (*Claims, error) {
 		}
 		return a.secret, nil
 	})
-	
+
 	if err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
 	}
-	
+
 	// Validate claims
 	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
 		// Validate issuer
 		if claims.Issuer != a.issuer {
 			return nil, ErrInvalidIssuer
 		}
-		
+
 		// Validate user ID
 		if claims.UserID == "" {
 			return nil, ErrMissingUserID
 		}
-		
+
 		return claims, nil
 	}
-	
+
 	return nil, ErrInvalidToken
 }
 
@@ -138,10 +167,15 @@ func (a *Authenticator) Middleware(next http.Handler) http.Handler {
 		// Validate token
 		claims, err := a.ValidateToken(tokenString)
 		if err != nil {
-			a.logger.Debug("jwt validation failed", 
+			a.logger.Debug("jwt validation failed",
 				zap.Error(err),
 				zap.String("token", tokenString[:min(len(tokenString), 20)]))
-			http.Error(w, "invalid token", http.StatusUnauthorized)
+
+			if errors.Is(err, ErrTokenRevoked) {
+				http.Error(w, "token revoked", http.StatusUnauthorized)
+			} else {
+				http.Error(w, "invalid token", http.StatusUnauthorized)
+			}
 			return
 		}
 		
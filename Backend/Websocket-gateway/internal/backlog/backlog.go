@@ -0,0 +1,256 @@
+// Package backlog buffers recently sent messages per user so that a
+// reconnecting device can replay anything it missed while offline,
+// identified by a monotonically increasing per-user sequence number.
+package backlog
+
+import (
+	"container/ring"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/yourcompany/websocket-gateway/internal/config"
+)
+
+var (
+	replayedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "backlog_replayed_messages_total",
+		Help: "Total number of backlog messages replayed to reconnecting clients",
+	})
+	droppedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "backlog_dropped_messages_total",
+		Help: "Total number of backlog messages dropped (ring overwrite or replay timeout)",
+	})
+)
+
+// Entry is a single buffered message, keyed by the sequence it was
+// appended at.
+type Entry struct {
+	Seq       uint64
+	MessageID string
+	Payload   []byte
+}
+
+// Manager buffers the last N messages per user in an in-memory ring,
+// with Redis used to persist the overflow so a node restart doesn't lose
+// recent history, and (when configured) to back the per-user sequence
+// counter so sequence numbers stay meaningful across a restart or a
+// reconnect to a different node.
+type Manager struct {
+	limit   int
+	timeout time.Duration
+	redis   redis.UniversalClient
+	prefix  string
+	logger  *zap.Logger
+
+	mu      sync.Mutex
+	buffers map[string]*userBuffer
+}
+
+type userBuffer struct {
+	mu      sync.Mutex
+	seq     uint64 // last seq handed out; only authoritative when redis is nil
+	ring    *ring.Ring
+	seenIDs map[string]struct{} // recent MessageIDs, for multi-device dedup
+}
+
+// NewManager creates a backlog manager. redisClient may be nil in tests,
+// in which case overflow beyond the in-memory ring is simply dropped.
+func NewManager(cfg *config.Config, redisClient redis.UniversalClient, logger *zap.Logger) *Manager {
+	return &Manager{
+		limit:   cfg.Backlog.Limit,
+		timeout: cfg.Backlog.BacklogTimeout,
+		redis:   redisClient,
+		prefix:  cfg.Backlog.RedisKeyPrefix,
+		logger:  logger,
+		buffers: make(map[string]*userBuffer),
+	}
+}
+
+func (m *Manager) bufferFor(userID string) *userBuffer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	buf, ok := m.buffers[userID]
+	if !ok {
+		buf = &userBuffer{
+			ring:    ring.New(m.limit),
+			seenIDs: make(map[string]struct{}),
+		}
+		m.buffers[userID] = buf
+	}
+	return buf
+}
+
+// Append records a message sent to userID, assigning it the next
+// sequence number. Messages already seen (same MessageID) are not
+// re-buffered, so multi-device fan-out doesn't create duplicate entries.
+func (m *Manager) Append(ctx context.Context, userID, messageID string, payload []byte) {
+	buf := m.bufferFor(userID)
+
+	buf.mu.Lock()
+	if _, dup := buf.seenIDs[messageID]; dup {
+		buf.mu.Unlock()
+		return
+	}
+
+	seq := m.nextSeq(ctx, userID, buf)
+	entry := Entry{Seq: seq, MessageID: messageID, Payload: payload}
+
+	if buf.ring.Value != nil {
+		droppedTotal.Inc()
+	}
+	buf.ring.Value = entry
+	buf.ring = buf.ring.Next()
+
+	buf.seenIDs[messageID] = struct{}{}
+	if len(buf.seenIDs) > m.limit {
+		// seenIDs only needs to cover messages still present in the ring.
+		buf.seenIDs = make(map[string]struct{}, m.limit)
+		buf.ring.Do(func(v interface{}) {
+			if e, ok := v.(Entry); ok {
+				buf.seenIDs[e.MessageID] = struct{}{}
+			}
+		})
+	}
+	buf.mu.Unlock()
+
+	if m.redis != nil {
+		m.persistOverflow(ctx, userID, entry)
+	}
+}
+
+// nextSeq returns the next sequence number for userID. When redis is
+// configured, the counter lives in Redis (shared across every node and
+// surviving process restarts), so a client's last_message_id cursor
+// stays meaningful after a restart or a reconnect to a different node.
+// Without redis (e.g. in tests), it falls back to the in-memory counter,
+// which is process-local only.
+func (m *Manager) nextSeq(ctx context.Context, userID string, buf *userBuffer) uint64 {
+	if m.redis == nil {
+		buf.seq++
+		return buf.seq
+	}
+
+	key := m.seqKey(userID)
+	pipe := m.redis.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, 7*24*time.Hour)
+	if _, err := pipe.Exec(ctx); err != nil {
+		m.logger.Warn("backlog: failed to increment shared seq counter, falling back to local",
+			zap.String("user_id", userID), zap.Error(err))
+		buf.seq++
+		return buf.seq
+	}
+
+	seq := uint64(incr.Val())
+	buf.seq = seq
+	return seq
+}
+
+func (m *Manager) seqKey(userID string) string {
+	return fmt.Sprintf("%s:backlog:seq:%s", m.prefix, userID)
+}
+
+func (m *Manager) persistOverflow(ctx context.Context, userID string, entry Entry) {
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	key := m.redisKey(userID)
+	pipe := m.redis.TxPipeline()
+	pipe.RPush(ctx, key, raw)
+	pipe.LTrim(ctx, key, int64(-m.limit), -1)
+	pipe.Expire(ctx, key, 7*24*time.Hour)
+	if _, err := pipe.Exec(ctx); err != nil {
+		m.logger.Warn("backlog: failed to persist overflow to redis",
+			zap.String("user_id", userID), zap.Error(err))
+	}
+}
+
+func (m *Manager) redisKey(userID string) string {
+	return fmt.Sprintf("%s:backlog:%s", m.prefix, userID)
+}
+
+// Replay invokes deliver for every buffered message with Seq > afterSeq,
+// in order, stopping early if the per-client backlogTimeout elapses. An
+// entry for which deliver returns false is counted as dropped and replay
+// moves on to the next one. It implements connection.BacklogReplayer.
+func (m *Manager) Replay(ctx context.Context, userID string, afterSeq uint64, deliver func(seq uint64, payload []byte) bool) error {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	entries := m.snapshotSince(userID, afterSeq)
+	if len(entries) == 0 && m.redis != nil {
+		var err error
+		entries, err = m.loadFromRedisSince(ctx, userID, afterSeq)
+		if err != nil {
+			return fmt.Errorf("backlog: load overflow: %w", err)
+		}
+	}
+
+	for i, entry := range entries {
+		select {
+		case <-ctx.Done():
+			droppedTotal.Add(float64(len(entries) - i))
+			return ctx.Err()
+		default:
+		}
+
+		if !deliver(entry.Seq, entry.Payload) {
+			droppedTotal.Inc()
+			continue
+		}
+		replayedTotal.Inc()
+	}
+
+	return nil
+}
+
+func (m *Manager) snapshotSince(userID string, afterSeq uint64) []Entry {
+	buf := m.bufferFor(userID)
+
+	buf.mu.Lock()
+	defer buf.mu.Unlock()
+
+	var entries []Entry
+	buf.ring.Do(func(v interface{}) {
+		if e, ok := v.(Entry); ok && e.Seq > afterSeq {
+			entries = append(entries, e)
+		}
+	})
+
+	// ring.Do walks in insertion order starting from the current
+	// cursor, which for a partially-filled or wrapped ring is not
+	// necessarily sequence order; sort defensively.
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Seq < entries[j].Seq })
+	return entries
+}
+
+func (m *Manager) loadFromRedisSince(ctx context.Context, userID string, afterSeq uint64) ([]Entry, error) {
+	raw, err := m.redis.LRange(ctx, m.redisKey(userID), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, s := range raw {
+		var e Entry
+		if err := json.Unmarshal([]byte(s), &e); err != nil {
+			continue
+		}
+		if e.Seq > afterSeq {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
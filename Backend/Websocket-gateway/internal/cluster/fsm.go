@@ -0,0 +1,151 @@
+package cluster
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// opAttach and opDetach are the two commands the FSM understands, each
+// proposed as a Raft log entry by the node that observed the event.
+const (
+	opAttach = "attach"
+	opDetach = "detach"
+)
+
+// command is the JSON-encoded payload of a single Raft log entry.
+type command struct {
+	Op          string    `json:"op"`
+	UserID      string    `json:"user_id"`
+	DeviceID    string    `json:"device_id"`
+	NodeID      string    `json:"node_id"`
+	ShardID     uint32    `json:"shard_id"`
+	ConnectedAt time.Time `json:"connected_at"`
+}
+
+// Entry describes one device's ownership: which node and shard hold its
+// connection, and when it attached.
+type Entry struct {
+	NodeID      string
+	ShardID     uint32
+	ConnectedAt time.Time
+}
+
+// fsm is the Raft-replicated state machine backing Registry: a compact
+// map of user_id -> device_id -> Entry, identical on every node once a
+// log entry commits. Reads never go through Raft -- Registry.Lookup
+// reads this map directly, guarded by mu, which is why it's safe to call
+// from any node regardless of leadership.
+type fsm struct {
+	mu      sync.RWMutex
+	devices map[string]map[string]Entry // userID -> deviceID -> Entry
+}
+
+func newFSM() *fsm {
+	return &fsm{devices: make(map[string]map[string]Entry)}
+}
+
+// Apply implements raft.FSM, applying one committed log entry.
+func (f *fsm) Apply(log *raft.Log) interface{} {
+	var cmd command
+	if err := json.Unmarshal(log.Data, &cmd); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch cmd.Op {
+	case opAttach:
+		devices, ok := f.devices[cmd.UserID]
+		if !ok {
+			devices = make(map[string]Entry)
+			f.devices[cmd.UserID] = devices
+		}
+		devices[cmd.DeviceID] = Entry{
+			NodeID:      cmd.NodeID,
+			ShardID:     cmd.ShardID,
+			ConnectedAt: cmd.ConnectedAt,
+		}
+	case opDetach:
+		if devices, ok := f.devices[cmd.UserID]; ok {
+			delete(devices, cmd.DeviceID)
+			if len(devices) == 0 {
+				delete(f.devices, cmd.UserID)
+			}
+		}
+	}
+
+	return nil
+}
+
+// lookup returns the owning entries for userID, or nil if the user has
+// no attached devices anywhere in the cluster.
+func (f *fsm) lookup(userID string) map[string]Entry {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	devices, ok := f.devices[userID]
+	if !ok {
+		return nil
+	}
+
+	out := make(map[string]Entry, len(devices))
+	for deviceID, entry := range devices {
+		out[deviceID] = entry
+	}
+	return out
+}
+
+// Snapshot implements raft.FSM.
+func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	devices := make(map[string]map[string]Entry, len(f.devices))
+	for userID, byDevice := range f.devices {
+		devices[userID] = make(map[string]Entry, len(byDevice))
+		for deviceID, entry := range byDevice {
+			devices[userID][deviceID] = entry
+		}
+	}
+
+	return &fsmSnapshot{devices: devices}, nil
+}
+
+// Restore implements raft.FSM, replacing the in-memory map wholesale
+// from a previously-persisted snapshot.
+func (f *fsm) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+
+	var devices map[string]map[string]Entry
+	if err := json.NewDecoder(rc).Decode(&devices); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	f.devices = devices
+	f.mu.Unlock()
+
+	return nil
+}
+
+type fsmSnapshot struct {
+	devices map[string]map[string]Entry
+}
+
+func (s *fsmSnapshot) Persist(sink raft.SnapshotSink) error {
+	err := func() error {
+		return json.NewEncoder(sink).Encode(s.devices)
+	}()
+	if err != nil {
+		sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+func (s *fsmSnapshot) Release() {}
@@ -0,0 +1,318 @@
+// Package cluster tracks, via a Raft-replicated state machine, which
+// node and shard currently hold each user's devices.
+//
+// Every gateway node runs a Registry. The node that accepts a
+// connection proposes an "attach" entry when the client authenticates
+// and a "detach" entry when it disconnects; Raft replicates both to
+// every node, and Owner reads the resulting map locally, so it never
+// blocks on cluster round-trips. Proposals themselves must go through
+// the Raft leader: a non-leader node forwards them over HTTP to
+// whichever node currently holds leadership.
+//
+// Today Owner is only consulted by connection.Manager.SendToUser, to
+// tell a user with no local connections who is genuinely offline apart
+// from one connected to a different node, so push-fallback isn't fired
+// for the latter. Actually routing an outbound message straight to the
+// node that owns the recipient -- instead of fanning it out to every
+// node over pub/sub -- is not implemented yet.
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb/v2"
+	"go.uber.org/zap"
+
+	"github.com/yourcompany/websocket-gateway/internal/config"
+	"github.com/yourcompany/websocket-gateway/internal/connection"
+)
+
+var _ connection.ClusterRegistry = (*Registry)(nil)
+
+const (
+	applyTimeout   = 5 * time.Second
+	forwardTimeout = 5 * time.Second
+	snapshotRetain = 2
+)
+
+// Registry is the cluster-wide, Raft-backed view of user ownership.
+type Registry struct {
+	raft   *raft.Raft
+	fsm    *fsm
+	nodeID string
+
+	// adminAddr is this node's own admin HTTP address (host:port, the
+	// same listener metrics.MetricsCollector mounts /debug/faults on).
+	// Peers are assumed to expose /cluster/propose on the same port, so
+	// a forward target is derived by pairing the leader's Raft host
+	// with this node's own admin port.
+	adminAddr string
+
+	httpClient *http.Client
+	logger     *zap.Logger
+}
+
+// NewRegistry starts (or rejoins) this node's Raft participant and
+// returns a ready-to-use Registry. adminAddr is this node's admin HTTP
+// address, used only to compute the port peers should forward
+// leader-only proposals to.
+func NewRegistry(cfg *config.Config, adminAddr string, logger *zap.Logger) (*Registry, error) {
+	if err := os.MkdirAll(cfg.Cluster.RaftDataDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create raft data dir: %w", err)
+	}
+
+	raftCfg := raft.DefaultConfig()
+	raftCfg.LocalID = raft.ServerID(cfg.Cluster.NodeID)
+	raftCfg.HeartbeatTimeout = cfg.Cluster.RaftHeartbeatTimeout
+	raftCfg.ElectionTimeout = cfg.Cluster.RaftElectionTimeout
+
+	addr, err := net.ResolveTCPAddr("tcp", cfg.Cluster.RaftBindAddr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid raft_bind_addr: %w", err)
+	}
+	transport, err := raft.NewTCPTransport(cfg.Cluster.RaftBindAddr, addr, 3, 10*time.Second, os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create raft transport: %w", err)
+	}
+
+	snapshots, err := raft.NewFileSnapshotStore(cfg.Cluster.RaftDataDir, snapshotRetain, os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create raft snapshot store: %w", err)
+	}
+
+	store, err := raftboltdb.NewBoltStore(filepath.Join(cfg.Cluster.RaftDataDir, "raft.db"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create raft log store: %w", err)
+	}
+
+	stateMachine := newFSM()
+
+	r, err := raft.NewRaft(raftCfg, stateMachine, store, store, snapshots, transport)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start raft: %w", err)
+	}
+
+	hasState, err := raft.HasExistingState(store, store, snapshots)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect raft state: %w", err)
+	}
+	if !hasState {
+		servers, err := bootstrapServers(cfg.Cluster.NodeID, cfg.Cluster.RaftBindAddr, cfg.Cluster.BootstrapPeers)
+		if err != nil {
+			return nil, err
+		}
+		if err := r.BootstrapCluster(raft.Configuration{Servers: servers}).Error(); err != nil {
+			return nil, fmt.Errorf("failed to bootstrap raft cluster: %w", err)
+		}
+	}
+
+	return &Registry{
+		raft:       r,
+		fsm:        stateMachine,
+		nodeID:     cfg.Cluster.NodeID,
+		adminAddr:  adminAddr,
+		httpClient: &http.Client{Timeout: forwardTimeout},
+		logger:     logger,
+	}, nil
+}
+
+// bootstrapServers builds the initial Raft configuration from
+// cfg.Cluster.BootstrapPeers, a list of "node_id@raft_bind_addr"
+// entries, adding this node itself if it isn't already listed.
+func bootstrapServers(selfID, selfAddr string, peers []string) ([]raft.Server, error) {
+	servers := []raft.Server{{ID: raft.ServerID(selfID), Address: raft.ServerAddress(selfAddr)}}
+
+	for _, peer := range peers {
+		id, addr, ok := strings.Cut(peer, "@")
+		if !ok {
+			return nil, fmt.Errorf("invalid bootstrap_peers entry %q, want \"node_id@host:port\"", peer)
+		}
+		if id == selfID {
+			continue
+		}
+		servers = append(servers, raft.Server{ID: raft.ServerID(id), Address: raft.ServerAddress(addr)})
+	}
+
+	return servers, nil
+}
+
+// Attach proposes that userID's deviceID is now connected to this node
+// on shardID. If this node isn't the Raft leader, the proposal is
+// forwarded to whichever node is.
+func (r *Registry) Attach(ctx context.Context, userID, deviceID string, shardID uint32) error {
+	return r.propose(ctx, command{
+		Op:          opAttach,
+		UserID:      userID,
+		DeviceID:    deviceID,
+		NodeID:      r.nodeID,
+		ShardID:     shardID,
+		ConnectedAt: time.Now(),
+	})
+}
+
+// Detach proposes that userID's deviceID is no longer connected
+// anywhere on this node.
+func (r *Registry) Detach(ctx context.Context, userID, deviceID string) error {
+	return r.propose(ctx, command{
+		Op:       opDetach,
+		UserID:   userID,
+		DeviceID: deviceID,
+		NodeID:   r.nodeID,
+	})
+}
+
+func (r *Registry) propose(ctx context.Context, cmd command) error {
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return fmt.Errorf("failed to encode cluster command: %w", err)
+	}
+
+	if r.raft.State() == raft.Leader {
+		return r.raft.Apply(data, applyTimeout).Error()
+	}
+
+	return r.forwardToLeader(ctx, data)
+}
+
+// forwardToLeader POSTs a raw command to the current leader's
+// /cluster/propose endpoint. The leader's Raft address is known from
+// raft.Leader(); its admin HTTP port is assumed identical to this
+// node's own (all nodes run the same configured admin port), so only
+// the host needs substituting.
+func (r *Registry) forwardToLeader(ctx context.Context, data []byte) error {
+	leaderAddr, _ := r.raft.LeaderWithID()
+	if leaderAddr == "" {
+		return fmt.Errorf("no raft leader available to forward cluster proposal to")
+	}
+
+	forwardAddr, err := leaderForwardAddr(string(leaderAddr), r.adminAddr)
+	if err != nil {
+		return fmt.Errorf("failed to derive leader forwarding address: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		fmt.Sprintf("http://%s/cluster/propose", forwardAddr), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to forward cluster proposal to leader at %s: %w", forwardAddr, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("leader at %s rejected forwarded cluster proposal: status %d", forwardAddr, resp.StatusCode)
+	}
+	return nil
+}
+
+// leaderForwardAddr pairs the leader's Raft host with this node's own
+// admin port, since every node in a deployment runs the admin listener
+// on the same configured port.
+func leaderForwardAddr(raftAddr, localAdminAddr string) (string, error) {
+	host, _, err := net.SplitHostPort(raftAddr)
+	if err != nil {
+		return "", err
+	}
+	_, port, err := net.SplitHostPort(localAdminAddr)
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// RegisterAdminRoutes mounts the leader-side proposal-forwarding
+// endpoint on mux. Only a Raft leader needs to accept forwarded
+// proposals, but every node mounts the route since leadership can move
+// at any time.
+func (r *Registry) RegisterAdminRoutes(mux *http.ServeMux) {
+	mux.Handle("/cluster/propose", http.HandlerFunc(r.handlePropose))
+	mux.Handle("/cluster/status", http.HandlerFunc(r.handleStatus))
+}
+
+func (r *Registry) handlePropose(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.raft.State() != raft.Leader {
+		http.Error(w, "not the raft leader", http.StatusMisdirectedRequest)
+		return
+	}
+
+	var cmd command
+	if err := json.NewDecoder(req.Body).Decode(&cmd); err != nil {
+		http.Error(w, "invalid cluster command", http.StatusBadRequest)
+		return
+	}
+
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := r.raft.Apply(data, applyTimeout).Error(); err != nil {
+		r.logger.Warn("failed to apply forwarded cluster proposal", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (r *Registry) handleStatus(w http.ResponseWriter, req *http.Request) {
+	leaderAddr, leaderID := r.raft.LeaderWithID()
+
+	status := struct {
+		NodeID   string `json:"node_id"`
+		State    string `json:"state"`
+		LeaderID string `json:"leader_id"`
+		Leader   string `json:"leader_addr"`
+	}{
+		NodeID:   r.nodeID,
+		State:    r.raft.State().String(),
+		LeaderID: string(leaderID),
+		Leader:   string(leaderAddr),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// Lookup returns every device currently attached for userID across the
+// whole cluster, read from this node's local FSM replica -- no Raft
+// round-trip, so it's safe to call on the hot path.
+func (r *Registry) Lookup(userID string) map[string]Entry {
+	return r.fsm.lookup(userID)
+}
+
+// Owner reports whether any node owns at least one of userID's devices,
+// and if so, one such node's ID. Used to decide whether a user with no
+// locally-connected clients is offline cluster-wide (eligible for push
+// fallback) or simply connected to a different node.
+func (r *Registry) Owner(userID string) (nodeID string, ok bool) {
+	for _, entry := range r.fsm.lookup(userID) {
+		return entry.NodeID, true
+	}
+	return "", false
+}
+
+// Shutdown gracefully leaves the Raft cluster.
+func (r *Registry) Shutdown() {
+	if err := r.raft.Shutdown().Error(); err != nil {
+		r.logger.Warn("error shutting down raft", zap.Error(err))
+	}
+}
@@ -21,6 +21,45 @@ type Config struct {
 		PingPeriod           time.Duration `mapstructure:"ping_period"`
 		MaxConnsPerIP        int           `mapstructure:"max_conns_per_ip"`
 		GracefulShutdownWait time.Duration `mapstructure:"graceful_shutdown_wait"`
+
+		// Outbound queue bounds each Client's per-connection backlog so a
+		// slow consumer can't grow memory unbounded. Crossing
+		// OutboundQueueHighWatermark triggers OutboundOverflowPolicy;
+		// dropping back to OutboundQueueLowWatermark resets that state.
+		// Valid policies: drop_oldest, drop_newest, disconnect,
+		// block_with_timeout, spill_to_redis.
+		OutboundQueueHighWatermark int           `mapstructure:"outbound_queue_high_watermark"`
+		OutboundQueueLowWatermark  int           `mapstructure:"outbound_queue_low_watermark"`
+		OutboundOverflowPolicy     string        `mapstructure:"outbound_overflow_policy"`
+		SlowClientTimeout          time.Duration `mapstructure:"slow_client_timeout"`
+
+		// TrustedProxies lists the CIDRs of reverse proxies/load balancers
+		// allowed to set X-Forwarded-For/Forwarded; empty means none are
+		// trusted and the immediate TCP peer is always used as the client IP.
+		TrustedProxies []string `mapstructure:"trusted_proxies"`
+
+		// ProxyProtocolEnabled expects every accepted connection to begin
+		// with a HAProxy PROXY protocol v1 or v2 header naming the real
+		// client address, for gateways sitting behind an L4 load balancer.
+		ProxyProtocolEnabled bool `mapstructure:"proxy_protocol_enabled"`
+
+		// EnabledTransports lists which of "websocket", "sse", and
+		// "longpoll" the server accepts connections on, so corporate
+		// proxies and mobile networks that break WebSocket upgrades can
+		// still fall back to one of the HTTP-based transports.
+		EnabledTransports    []string      `mapstructure:"enabled_transports"`
+		SSEKeepaliveInterval time.Duration `mapstructure:"sse_keepalive_interval"`
+		LongPollMaxWait      time.Duration `mapstructure:"long_poll_max_wait"`
+
+		// EnablePermessageDeflate negotiates RFC 7692 per-message deflate
+		// on the WebSocket upgrade. CompressionLevel is the flate level
+		// (0-9, or -1 for the library default) used once negotiated.
+		// Messages smaller than CompressionMinSize skip compression
+		// entirely, since deflating a few bytes costs more CPU than it
+		// saves in bytes on the wire.
+		EnablePermessageDeflate bool `mapstructure:"enable_permessage_deflate"`
+		CompressionLevel        int  `mapstructure:"compression_level"`
+		CompressionMinSize      int  `mapstructure:"compression_min_size"`
 	} `mapstructure:"server"`
 
 	Auth struct {
@@ -28,6 +67,21 @@ type Config struct {
 		TokenExpiry         time.Duration `mapstructure:"token_expiry"`
 		AuthTimeout         time.Duration `mapstructure:"auth_timeout"`
 		RequireAuthOnConnect bool         `mapstructure:"require_auth_on_connect"`
+
+		// Optional RFC 7662 token introspection, layered on top of the
+		// HMAC signature check so revocation is picked up within
+		// TokenTrustCacheExpiration instead of only at token expiry.
+		IntrospectionURL               string        `mapstructure:"introspection_url"`
+		IntrospectionClientID          string        `mapstructure:"introspection_client_id"`
+		IntrospectionClientSecret      string        `mapstructure:"introspection_client_secret"`
+		TokenTrustCacheExpiration      time.Duration `mapstructure:"token_trust_cache_expiration"`
+		TokenTrustNegativeCacheExpiration time.Duration `mapstructure:"token_trust_negative_cache_expiration"`
+
+		// TokenTrustCacheSize bounds the introspection trust cache to an
+		// LRU of at most this many entries, so a token validated once and
+		// never looked up again doesn't sit in memory until its TTL is
+		// next checked (or forever, if it never is).
+		TokenTrustCacheSize int `mapstructure:"token_trust_cache_size"`
 	} `mapstructure:"auth"`
 
 	Cluster struct {
@@ -35,6 +89,20 @@ type Config struct {
 		ServiceDiscoveryURL string        `mapstructure:"service_discovery_url"`
 		HeartbeatInterval   time.Duration `mapstructure:"heartbeat_interval"`
 		StickySessionSecret string        `mapstructure:"sticky_session_secret"`
+
+		// Raft-backed registry (internal/cluster) tracking which node owns
+		// each connected user, currently consulted to suppress push
+		// fallback for a user connected elsewhere in the cluster.
+		// RaftBindAddr is this node's host:port for the Raft transport,
+		// distinct from Server.Host/Port and Observability.MetricsPort.
+		// BootstrapPeers lists node_id@raft_bind_addr pairs for the
+		// initial cluster only; once formed, membership changes go
+		// through Raft itself.
+		RaftBindAddr         string        `mapstructure:"raft_bind_addr"`
+		RaftDataDir          string        `mapstructure:"raft_data_dir"`
+		BootstrapPeers       []string      `mapstructure:"bootstrap_peers"`
+		RaftHeartbeatTimeout time.Duration `mapstructure:"raft_heartbeat_timeout"`
+		RaftElectionTimeout  time.Duration `mapstructure:"raft_election_timeout"`
 	} `mapstructure:"cluster"`
 
 	Redis struct {
@@ -53,11 +121,29 @@ type Config struct {
 		DurableConsumer     bool          `mapstructure:"durable_consumer"`
 	} `mapstructure:"nats"`
 
+	PubSub struct {
+		// Backend selects the cross-node fan-out implementation: "redis"
+		// (default, at-most-once pub/sub) or "nats" (durable JetStream
+		// delivery, survives a subscriber being briefly disconnected).
+		Backend             string        `mapstructure:"backend"`
+	} `mapstructure:"pubsub"`
+
 	RateLimit struct {
 		MessagesPerSecond   int           `mapstructure:"messages_per_second"`
 		Burst               int           `mapstructure:"burst"`
 		ConnectionsPerUser  int           `mapstructure:"connections_per_user"`
 		GlobalConnections   int           `mapstructure:"global_connections"`
+
+		// Cluster-wide sliding-window limit on new connections per IP,
+		// enforced in Redis so a reconnect storm from one address is
+		// rejected everywhere, not just on the node it happens to hit.
+		ConnectionsPerIPWindow time.Duration `mapstructure:"connections_per_ip_window"`
+		ConnectionsPerIPLimit  int           `mapstructure:"connections_per_ip_limit"`
+
+		// BackpressureBlockTimeout bounds how long WriteMessage blocks the
+		// caller under Server.OutboundOverflowPolicy "block_with_timeout"
+		// before giving up and disconnecting the slow client.
+		BackpressureBlockTimeout time.Duration `mapstructure:"backpressure_block_timeout"`
 	} `mapstructure:"rate_limit"`
 
 	Observability struct {
@@ -65,12 +151,39 @@ type Config struct {
 		LogLevel            string        `mapstructure:"log_level"`
 		EnableTracing       bool          `mapstructure:"enable_tracing"`
 		OtelEndpoint        string        `mapstructure:"otel_endpoint"`
+
+		// FaultInjectionEnabled turns on the connection/faultinject
+		// chaos-testing harness: its admin API (POST/GET/DELETE
+		// /debug/faults) is mounted and new connections become eligible
+		// for scenario-matched fault wrapping. Leave off in production.
+		FaultInjectionEnabled bool `mapstructure:"fault_injection_enabled"`
 	} `mapstructure:"observability"`
 
 	Sharding struct {
 		ShardCount          int           `mapstructure:"shard_count"`
 		ShardKey            string        `mapstructure:"shard_key"`
 	} `mapstructure:"sharding"`
+
+	Presence struct {
+		IdleThreshold       time.Duration `mapstructure:"idle_threshold"`
+	} `mapstructure:"presence"`
+
+	Backlog struct {
+		Limit               int           `mapstructure:"limit"`
+		BacklogTimeout      time.Duration `mapstructure:"backlog_timeout"`
+		RedisKeyPrefix      string        `mapstructure:"redis_key_prefix"`
+	} `mapstructure:"backlog"`
+
+	WebPush struct {
+		Enabled             bool          `mapstructure:"enabled"`
+		VAPIDPublicKey      string        `mapstructure:"vapid_public_key"`
+		VAPIDPrivateKey     string        `mapstructure:"vapid_private_key"`
+		VAPIDSubject        string        `mapstructure:"vapid_subject"`
+		MaxPayloadSize      int           `mapstructure:"max_payload_size"`
+		SendTimeout         time.Duration `mapstructure:"send_timeout"`
+		ExpiredGracePeriod  time.Duration `mapstructure:"expired_grace_period"`
+		RecheckInterval     time.Duration `mapstructure:"recheck_interval"`
+	} `mapstructure:"webpush"`
 }
 
 func Load() (*Config, error) {
@@ -117,12 +230,32 @@ func setDefaults() {
 	viper.SetDefault("server.ping_period", 54*time.Second) // 90% of pong_wait
 	viper.SetDefault("server.max_conns_per_ip", 10)
 	viper.SetDefault("server.graceful_shutdown_wait", 30*time.Second)
+	viper.SetDefault("server.outbound_queue_high_watermark", 512)
+	viper.SetDefault("server.outbound_queue_low_watermark", 128)
+	viper.SetDefault("server.outbound_overflow_policy", "drop_oldest")
+	viper.SetDefault("server.slow_client_timeout", 30*time.Second)
+	viper.SetDefault("server.trusted_proxies", []string{})
+	viper.SetDefault("server.proxy_protocol_enabled", false)
+	viper.SetDefault("server.enabled_transports", []string{"websocket"})
+	viper.SetDefault("server.sse_keepalive_interval", 15*time.Second)
+	viper.SetDefault("server.long_poll_max_wait", 25*time.Second)
+	viper.SetDefault("server.enable_permessage_deflate", true)
+	viper.SetDefault("server.compression_level", 6)
+	viper.SetDefault("server.compression_min_size", 256)
 
 	viper.SetDefault("auth.auth_timeout", 5*time.Second)
 	viper.SetDefault("auth.require_auth_on_connect", true)
+	viper.SetDefault("auth.token_trust_cache_expiration", 30*time.Second)
+	viper.SetDefault("auth.token_trust_negative_cache_expiration", 5*time.Second)
+	viper.SetDefault("auth.token_trust_cache_size", 10000)
 
 	viper.SetDefault("cluster.node_id", generateNodeID())
 	viper.SetDefault("cluster.heartbeat_interval", 5*time.Second)
+	viper.SetDefault("cluster.raft_bind_addr", "0.0.0.0:7946")
+	viper.SetDefault("cluster.raft_data_dir", "./data/raft")
+	viper.SetDefault("cluster.bootstrap_peers", []string{})
+	viper.SetDefault("cluster.raft_heartbeat_timeout", time.Second)
+	viper.SetDefault("cluster.raft_election_timeout", time.Second)
 
 	viper.SetDefault("redis.addresses", []string{"localhost:6379"})
 	viper.SetDefault("redis.pool_size", 100)
@@ -133,17 +266,35 @@ func setDefaults() {
 	viper.SetDefault("nats.consumer_name", "websocket-gateway")
 	viper.SetDefault("nats.durable_consumer", true)
 
+	viper.SetDefault("pubsub.backend", "redis")
+
 	viper.SetDefault("rate_limit.messages_per_second", 100)
 	viper.SetDefault("rate_limit.burst", 150)
 	viper.SetDefault("rate_limit.connections_per_user", 5)
 	viper.SetDefault("rate_limit.global_connections", 1000000)
+	viper.SetDefault("rate_limit.connections_per_ip_window", time.Minute)
+	viper.SetDefault("rate_limit.connections_per_ip_limit", 20)
+	viper.SetDefault("rate_limit.backpressure_block_timeout", 500*time.Millisecond)
 
 	viper.SetDefault("observability.metrics_port", 9090)
 	viper.SetDefault("observability.log_level", "info")
 	viper.SetDefault("observability.enable_tracing", false)
+	viper.SetDefault("observability.fault_injection_enabled", false)
 
 	viper.SetDefault("sharding.shard_count", 64)
 	viper.SetDefault("sharding.shard_key", "user_id")
+
+	viper.SetDefault("presence.idle_threshold", 5*time.Minute)
+
+	viper.SetDefault("backlog.limit", 4000)
+	viper.SetDefault("backlog.backlog_timeout", 3*time.Second)
+	viper.SetDefault("backlog.redis_key_prefix", "ws-gateway")
+
+	viper.SetDefault("webpush.enabled", false)
+	viper.SetDefault("webpush.max_payload_size", 4*1024) // 4KB, per RFC 8030
+	viper.SetDefault("webpush.send_timeout", 5*time.Second)
+	viper.SetDefault("webpush.expired_grace_period", 30*24*time.Hour)
+	viper.SetDefault("webpush.recheck_interval", 24*time.Hour)
 }
 
 func generateNodeID() string {
@@ -167,6 +318,24 @@ func validateConfig(cfg *Config) error {
 	if cfg.RateLimit.GlobalConnections <= 0 {
 		return fmt.Errorf("global_connections limit must be positive")
 	}
-	
+
+	switch cfg.Server.OutboundOverflowPolicy {
+	case "drop_oldest", "drop_newest", "disconnect", "block_with_timeout", "spill_to_redis":
+	default:
+		return fmt.Errorf("outbound_overflow_policy must be one of \"drop_oldest\", \"drop_newest\", \"disconnect\", \"block_with_timeout\", \"spill_to_redis\"")
+	}
+
+	if cfg.Server.OutboundQueueLowWatermark >= cfg.Server.OutboundQueueHighWatermark {
+		return fmt.Errorf("outbound_queue_low_watermark must be less than outbound_queue_high_watermark")
+	}
+
+	if cfg.Cluster.RaftHeartbeatTimeout > cfg.Cluster.RaftElectionTimeout {
+		return fmt.Errorf("raft_heartbeat_timeout must not exceed raft_election_timeout")
+	}
+
+	if cfg.Server.CompressionLevel != -1 && (cfg.Server.CompressionLevel < 0 || cfg.Server.CompressionLevel > 9) {
+		return fmt.Errorf("compression_level must be -1 (default) or between 0 and 9")
+	}
+
 	return nil
 }
@@ -0,0 +1,234 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// Manager owns the single live *Config shared by every subsystem
+// (connection.Manager, WebSocketServer, ...) and applies SIGHUP-triggered
+// reloads to it in place, so code already holding that pointer sees
+// updated values on its next read without being restarted or re-wired.
+//
+// Only a safe subset of fields is mutated in place on reload: anything
+// tied to an already-provisioned resource (listener address/port, shard
+// count, node identity, secrets) is left untouched, since applying it
+// live would leave the process in a state that doesn't match what it
+// actually has open. See applySafeSubset for the exact list. NATS/Redis
+// credentials are a partial exception: they aren't part of the safe
+// subset copied onto live Config, but OnChange subscribers (see
+// internal/server's WebSocketServer construction) can react to them
+// changing by reconnecting the affected client directly -- supported for
+// the NATS pub/sub backend, not yet for Redis.
+type Manager struct {
+	mu  sync.RWMutex
+	cfg *Config
+
+	logger *zap.Logger
+
+	onChangeMu sync.Mutex
+	onChange   []func(old, new *Config)
+}
+
+// NewManager wraps an already-loaded Config for hot reload. cfg must be
+// the same pointer every other subsystem was constructed with; Reload
+// mutates it in place rather than replacing it.
+func NewManager(cfg *Config, logger *zap.Logger) *Manager {
+	return &Manager{cfg: cfg, logger: logger}
+}
+
+// OnChange registers a callback invoked after every successful reload,
+// including one that changed nothing, with both the pre-reload snapshot
+// and the live (now updated) Config. A reload that fails to read,
+// unmarshal or validate does not invoke it. Used for state that lives outside *Config entirely,
+// e.g. syncing logging.NewLogger's zap.AtomicLevel to Observability.LogLevel.
+func (m *Manager) OnChange(fn func(old, new *Config)) {
+	m.onChangeMu.Lock()
+	defer m.onChangeMu.Unlock()
+	m.onChange = append(m.onChange, fn)
+}
+
+// Watch starts a background goroutine that reloads config on SIGHUP or
+// whenever the config file changes on disk, until stop is closed.
+func (m *Manager) Watch(stop <-chan struct{}) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+
+	viper.OnConfigChange(func(e fsnotify.Event) {
+		m.logger.Info("config file changed on disk, reloading", zap.String("file", e.Name))
+		if err := m.Reload(); err != nil {
+			m.logger.Error("config reload failed", zap.Error(err))
+		}
+	})
+	viper.WatchConfig()
+
+	go func() {
+		defer signal.Stop(sighup)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-sighup:
+				m.logger.Info("received SIGHUP, reloading config")
+				if err := m.Reload(); err != nil {
+					m.logger.Error("config reload failed", zap.Error(err))
+				}
+			}
+		}
+	}()
+}
+
+// Get returns a point-in-time copy of the live Config. Reload mutates
+// fields on the shared *Config in place, so any code that reads it
+// concurrently with a possible reload -- rather than only at startup,
+// before Watch is running -- should read through Get instead of holding
+// onto the raw pointer directly.
+func (m *Manager) Get() Config {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return *m.cfg
+}
+
+// Reload re-reads the config file and environment via viper and applies
+// the safe subset of changes to the live Config in place, leaving
+// connections and already-provisioned resources untouched.
+func (m *Manager) Reload() error {
+	if err := viper.ReadInConfig(); err != nil {
+		return fmt.Errorf("config: reload: re-reading config file: %w", err)
+	}
+
+	var next Config
+	if err := viper.Unmarshal(&next); err != nil {
+		return fmt.Errorf("config: reload: unmarshal: %w", err)
+	}
+	if err := validateConfig(&next); err != nil {
+		return fmt.Errorf("config: reload: %w", err)
+	}
+
+	m.mu.Lock()
+	old := *m.cfg
+	changed := applySafeSubset(m.cfg, &next)
+	m.mu.Unlock()
+
+	if len(changed) == 0 {
+		m.logger.Info("config reload: no safe-reloadable fields changed")
+	} else {
+		m.logger.Info("config reloaded", zap.Strings("changed_fields", changed))
+	}
+
+	m.onChangeMu.Lock()
+	callbacks := append([]func(old, new *Config){}, m.onChange...)
+	m.onChangeMu.Unlock()
+
+	for _, fn := range callbacks {
+		fn(&old, m.cfg)
+	}
+
+	return nil
+}
+
+// applySafeSubset copies the fields that are safe to change without a
+// restart from next onto live, returning the mapstructure-style names of
+// the ones whose value actually changed. Everything not listed here --
+// listener host/port, buffer sizes, shard count, Redis/NATS addresses,
+// node identity, secrets -- is intentionally left alone: those are either
+// baked into already-provisioned resources (bound listeners, shard
+// arrays, connection pools) or risky to rotate silently.
+func applySafeSubset(live, next *Config) []string {
+	var changed []string
+
+	apply := func(field string, eq bool, set func()) {
+		if eq {
+			return
+		}
+		set()
+		changed = append(changed, field)
+	}
+
+	apply("server.write_wait", live.Server.WriteWait == next.Server.WriteWait,
+		func() { live.Server.WriteWait = next.Server.WriteWait })
+	apply("server.pong_wait", live.Server.PongWait == next.Server.PongWait,
+		func() { live.Server.PongWait = next.Server.PongWait })
+	apply("server.ping_period", live.Server.PingPeriod == next.Server.PingPeriod,
+		func() { live.Server.PingPeriod = next.Server.PingPeriod })
+	apply("server.max_conns_per_ip", live.Server.MaxConnsPerIP == next.Server.MaxConnsPerIP,
+		func() { live.Server.MaxConnsPerIP = next.Server.MaxConnsPerIP })
+	apply("server.graceful_shutdown_wait", live.Server.GracefulShutdownWait == next.Server.GracefulShutdownWait,
+		func() { live.Server.GracefulShutdownWait = next.Server.GracefulShutdownWait })
+	apply("server.outbound_queue_high_watermark", live.Server.OutboundQueueHighWatermark == next.Server.OutboundQueueHighWatermark,
+		func() { live.Server.OutboundQueueHighWatermark = next.Server.OutboundQueueHighWatermark })
+	apply("server.outbound_queue_low_watermark", live.Server.OutboundQueueLowWatermark == next.Server.OutboundQueueLowWatermark,
+		func() { live.Server.OutboundQueueLowWatermark = next.Server.OutboundQueueLowWatermark })
+	apply("server.outbound_overflow_policy", live.Server.OutboundOverflowPolicy == next.Server.OutboundOverflowPolicy,
+		func() { live.Server.OutboundOverflowPolicy = next.Server.OutboundOverflowPolicy })
+	apply("server.slow_client_timeout", live.Server.SlowClientTimeout == next.Server.SlowClientTimeout,
+		func() { live.Server.SlowClientTimeout = next.Server.SlowClientTimeout })
+	apply("server.trusted_proxies", stringSlicesEqual(live.Server.TrustedProxies, next.Server.TrustedProxies),
+		func() { live.Server.TrustedProxies = next.Server.TrustedProxies })
+	apply("server.sse_keepalive_interval", live.Server.SSEKeepaliveInterval == next.Server.SSEKeepaliveInterval,
+		func() { live.Server.SSEKeepaliveInterval = next.Server.SSEKeepaliveInterval })
+	apply("server.long_poll_max_wait", live.Server.LongPollMaxWait == next.Server.LongPollMaxWait,
+		func() { live.Server.LongPollMaxWait = next.Server.LongPollMaxWait })
+
+	apply("auth.token_expiry", live.Auth.TokenExpiry == next.Auth.TokenExpiry,
+		func() { live.Auth.TokenExpiry = next.Auth.TokenExpiry })
+	apply("auth.auth_timeout", live.Auth.AuthTimeout == next.Auth.AuthTimeout,
+		func() { live.Auth.AuthTimeout = next.Auth.AuthTimeout })
+	apply("auth.require_auth_on_connect", live.Auth.RequireAuthOnConnect == next.Auth.RequireAuthOnConnect,
+		func() { live.Auth.RequireAuthOnConnect = next.Auth.RequireAuthOnConnect })
+	// auth.token_trust_cache_expiration/negative_expiration and
+	// cluster.heartbeat_interval are intentionally not in this list: the
+	// former are copied once into internal/auth's introspector at
+	// construction time and never re-read live, and the latter is not
+	// read by any subsystem (internal/cluster's registry uses the raft_*
+	// timeouts instead), so mutating live.Auth/live.Cluster here would
+	// change a value nothing actually consults, while Reload's
+	// changed_fields logging made it look like it had taken effect.
+
+	apply("rate_limit.messages_per_second", live.RateLimit.MessagesPerSecond == next.RateLimit.MessagesPerSecond,
+		func() { live.RateLimit.MessagesPerSecond = next.RateLimit.MessagesPerSecond })
+	apply("rate_limit.burst", live.RateLimit.Burst == next.RateLimit.Burst,
+		func() { live.RateLimit.Burst = next.RateLimit.Burst })
+	apply("rate_limit.connections_per_user", live.RateLimit.ConnectionsPerUser == next.RateLimit.ConnectionsPerUser,
+		func() { live.RateLimit.ConnectionsPerUser = next.RateLimit.ConnectionsPerUser })
+	apply("rate_limit.global_connections", live.RateLimit.GlobalConnections == next.RateLimit.GlobalConnections,
+		func() { live.RateLimit.GlobalConnections = next.RateLimit.GlobalConnections })
+	apply("rate_limit.connections_per_ip_window", live.RateLimit.ConnectionsPerIPWindow == next.RateLimit.ConnectionsPerIPWindow,
+		func() { live.RateLimit.ConnectionsPerIPWindow = next.RateLimit.ConnectionsPerIPWindow })
+	apply("rate_limit.connections_per_ip_limit", live.RateLimit.ConnectionsPerIPLimit == next.RateLimit.ConnectionsPerIPLimit,
+		func() { live.RateLimit.ConnectionsPerIPLimit = next.RateLimit.ConnectionsPerIPLimit })
+	apply("rate_limit.backpressure_block_timeout", live.RateLimit.BackpressureBlockTimeout == next.RateLimit.BackpressureBlockTimeout,
+		func() { live.RateLimit.BackpressureBlockTimeout = next.RateLimit.BackpressureBlockTimeout })
+
+	apply("observability.log_level", live.Observability.LogLevel == next.Observability.LogLevel,
+		func() { live.Observability.LogLevel = next.Observability.LogLevel })
+
+	// presence.idle_threshold, backlog.limit, backlog.backlog_timeout and
+	// webpush.* are deliberately not reloaded here either, for the same
+	// reason as the auth/cluster fields above: internal/presence,
+	// internal/backlog and internal/webpush each take their config as a
+	// constructor argument and never read it again afterwards, so there's
+	// nothing live to mutate short of rebuilding those managers outright,
+	// which is out of scope for this reload mechanism.
+
+	return changed
+}
+
+func stringSlicesEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
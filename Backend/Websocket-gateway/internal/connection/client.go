@@ -2,43 +2,88 @@ package connection
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 	"golang.org/x/time/rate"
 
+	"github.com/yourcompany/websocket-gateway/internal/logging"
 	"github.com/yourcompany/websocket-gateway/pkg/protocol"
 )
 
-// Client represents a single WebSocket connection
+// Client represents a single client connection, independent of which
+// Transport (WebSocket, SSE, or long-poll) it was established over.
 type Client struct {
 	ID           string
 	UserID       string
 	DeviceID     string
 	IP           string
-	Conn         *websocket.Conn
-	Send         chan []byte
+	transport    Transport
 	RateLimiter  *rate.Limiter
 	ConnectedAt  time.Time
 	LastActivity time.Time
 	ShardID      uint32
-	
+
+	// outbound is the bounded, coalescing queue WriteMessage enqueues
+	// into and WritePump drains; outboundNotify wakes WritePump when
+	// there's something new to send.
+	outbound       *outboundQueue
+	outboundNotify chan struct{}
+
+	// pingInterval is how often WritePump sends a transport keepalive.
+	// Transports tune this independently (e.g. Server.SSEKeepaliveInterval
+	// for SSE) since their idle-timeout characteristics differ from a raw
+	// WebSocket's pong wait.
+	pingInterval time.Duration
+
+	// blockTimeout bounds how long WriteMessage will wait for outbound
+	// queue capacity under OverflowBlockWithTimeout before giving up and
+	// disconnecting the client.
+	blockTimeout time.Duration
+
+	// redisClient and redisKeyPrefix back OverflowSpillToRedis: entries
+	// that would otherwise overflow the local queue are RPUSHed to
+	// overflowKey() and drained back in as capacity frees up. Both are
+	// nil/empty unless that policy is configured.
+	redisClient    redis.UniversalClient
+	redisKeyPrefix string
+
+	// codec is the wire encoding this client negotiated over
+	// Sec-WebSocket-Protocol (json.v1, msgpack.v1, or cbor.v1). Every
+	// other part of Client and Manager still deals in canonical JSON;
+	// flushOutbound transcodes to codec right before writing, and
+	// ReadPump transcodes back to JSON right after reading, so the
+	// negotiated codec never leaks past the transport boundary.
+	codec protocol.Codec
+
+	// compressionEnabled and compressionMinSize back per-message deflate:
+	// flushOutbound skips compression for payloads smaller than
+	// compressionMinSize. The flate level itself is fixed per-connection
+	// at upgrade time (gorilla has no per-message level), so it isn't
+	// stored here. A no-op for transports that don't implement
+	// CompressionController.
+	compressionEnabled bool
+	compressionMinSize int
+
 	// Context for cancellation
 	ctx        context.Context
 	cancel     context.CancelFunc
-	
+
 	// Mutex for thread-safe operations
 	mu         sync.RWMutex
-	
+
 	// State
 	authenticated bool
 	closing       bool
-	
+
 	// Metrics
 	metrics     *ClientMetrics
-	
+
 	logger      *zap.Logger
 }
 
@@ -48,36 +93,89 @@ type ClientMetrics struct {
 	BytesSent        int64
 	BytesReceived    int64
 	LastPingTime     time.Time
+
+	// BytesSentCompressed is the estimated on-wire size of every
+	// compressed outbound message (see flushOutbound), measured by
+	// deflating a copy of the payload at flate.DefaultCompression, not
+	// the connection's configured level -- gorilla's own
+	// permessage-deflate writer doesn't expose
+	// the compressed size it actually puts on the wire.
+	BytesSentCompressed int64
+
+	// CompressionRatio is BytesSent / BytesSentCompressed as of the most
+	// recent compressed write, i.e. how many bytes of canonical JSON
+	// payload went out per byte actually sent. 1 until anything's been
+	// compressed.
+	CompressionRatio float64
 }
 
-// NewClient creates a new client connection
+// NewClient creates a new client connection over the given transport.
+// outboundMetrics may be nil (no telemetry recorded) if the caller hasn't
+// wired one up.
 func NewClient(
-	conn *websocket.Conn,
+	transport Transport,
 	clientID string,
 	ip string,
 	shardID uint32,
 	rateLimit rate.Limit,
 	burst int,
+	outboundHighWatermark int,
+	outboundLowWatermark int,
+	outboundPolicy OverflowPolicy,
+	slowClientTimeout time.Duration,
+	pingInterval time.Duration,
+	blockTimeout time.Duration,
+	redisClient redis.UniversalClient,
+	redisKeyPrefix string,
+	outboundMetrics OutboundMetricsRecorder,
+	codec protocol.Codec,
+	compressionEnabled bool,
+	compressionMinSize int,
 	logger *zap.Logger,
 ) *Client {
 	ctx, cancel := context.WithCancel(context.Background())
-	
+
+	if pingInterval <= 0 {
+		pingInterval = 54 * time.Second // 90% of the default 60s pong wait
+	}
+
+	if codec == nil {
+		codec = protocol.JSON
+	}
+
 	return &Client{
-		ID:           clientID,
-		IP:           ip,
-		Conn:         conn,
-		Send:         make(chan []byte, 256), // Buffered channel
-		RateLimiter:  rate.NewLimiter(rateLimit, burst),
-		ConnectedAt:  time.Now(),
-		LastActivity: time.Now(),
-		ShardID:      shardID,
-		ctx:          ctx,
-		cancel:       cancel,
-		metrics:      &ClientMetrics{},
-		logger:       logger.With(zap.String("client_id", clientID)),
+		ID:                 clientID,
+		IP:                 ip,
+		transport:          transport,
+		outbound:           newOutboundQueue(outboundHighWatermark, outboundLowWatermark, outboundPolicy, slowClientTimeout, outboundMetrics),
+		outboundNotify:     make(chan struct{}, 1),
+		pingInterval:       pingInterval,
+		blockTimeout:       blockTimeout,
+		redisClient:        redisClient,
+		redisKeyPrefix:     redisKeyPrefix,
+		codec:              codec,
+		compressionEnabled: compressionEnabled,
+		compressionMinSize: compressionMinSize,
+		RateLimiter:        rate.NewLimiter(rateLimit, burst),
+		ConnectedAt:        time.Now(),
+		LastActivity:       time.Now(),
+		ShardID:            shardID,
+		ctx:                ctx,
+		cancel:             cancel,
+		metrics:            &ClientMetrics{CompressionRatio: 1},
+		logger:             logger.With(zap.String("client_id", clientID)),
 	}
 }
 
+// RebuildRateLimiter applies a new rate and burst to the client's
+// existing RateLimiter in place (rate.Limiter is safe for concurrent
+// use), so a config reload takes effect for already-connected clients
+// instead of only new ones.
+func (c *Client) RebuildRateLimiter(messagesPerSecond rate.Limit, burst int) {
+	c.RateLimiter.SetLimit(messagesPerSecond)
+	c.RateLimiter.SetBurst(burst)
+}
+
 // SetAuthenticated marks the client as authenticated
 func (c *Client) SetAuthenticated(userID, deviceID string) {
 	c.mu.Lock()
@@ -96,26 +194,208 @@ func (c *Client) IsAuthenticated() bool {
 	return c.authenticated
 }
 
-// WriteMessage sends a message to the client
-func (c *Client) WriteMessage(message []byte) error {
+// Context returns the client's cancellation context with its per-connection
+// logger (client_id, and user_id once authenticated) embedded via
+// logging.WithContext, for handlers that take a context.Context rather than
+// a *Client.
+func (c *Client) Context() context.Context {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	
-	if c.closing {
+	return logging.WithContext(c.ctx, c.logger)
+}
+
+// WriteMessage enqueues a message for delivery to the client. Presence and
+// typing updates coalesce with any already-queued update for the same
+// subject rather than piling up. What happens once the outbound queue
+// reaches its high watermark depends on the configured OverflowPolicy:
+// drop_newest/drop_oldest silently shed messages, block_with_timeout
+// blocks the caller until capacity frees or disconnects the client with
+// ErrClientSlow, spill_to_redis persists the overflow for later draining,
+// and disconnect disconnects once the watermark's been exceeded for longer
+// than the configured slow-client timeout.
+func (c *Client) WriteMessage(message []byte) error {
+	c.mu.RLock()
+	closing := c.closing
+	c.mu.RUnlock()
+
+	if closing {
 		return ErrClientClosed
 	}
-	
-	select {
-	case c.Send <- message:
+
+	key := outboundCoalesceKey(message)
+
+	if c.outbound.policy == OverflowBlockWithTimeout {
+		if !c.outbound.waitForCapacity(c.blockTimeout) {
+			c.outbound.recordBlockTimeout()
+			c.logger.Warn("client outbound queue still full after block timeout, disconnecting slow consumer")
+			go c.Close("slow_consumer")
+			return ErrClientSlow
+		}
+	}
+
+	switch c.outbound.push(message, key) {
+	case outboundDropped:
+		return nil
+
+	case outboundSpill:
+		c.spillOverflow(message, key)
 		c.metrics.MessagesSent++
 		c.metrics.BytesSent += int64(len(message))
 		return nil
-	default:
-		// Channel is full - client is too slow
-		c.logger.Warn("client send channel full, dropping message",
-			zap.Int("channel_size", len(c.Send)))
+
+	case outboundDisconnect:
+		c.logger.Warn("client exceeded outbound high watermark, disconnecting slow consumer")
+		go c.Close("slow_consumer")
 		return ErrClientSlow
 	}
+
+	c.metrics.MessagesSent++
+	c.metrics.BytesSent += int64(len(message))
+
+	select {
+	case c.outboundNotify <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// overflowListTTL bounds how long a spilled overflow list survives with
+// no draining activity, so a client that spills and never reconnects
+// doesn't leak its Redis key forever.
+const overflowListTTL = 1 * time.Hour
+
+// overflowKey returns the Redis key this client's spilled outbound
+// messages live under. Once authenticated it's keyed by the stable
+// userID:deviceID identity rather than the per-connection ID (which
+// RegisterHandlers/AddConnection regenerates on every reconnect), so a
+// reconnecting client's previous connection's spilled messages are still
+// found and drained, in order, instead of orphaned. Before
+// authentication there's no stable identity yet, so it falls back to
+// the per-connection ID.
+func (c *Client) overflowKey() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.UserID != "" && c.DeviceID != "" {
+		return c.redisKeyPrefix + ":overflow:" + c.UserID + ":" + c.DeviceID
+	}
+	return c.redisKeyPrefix + ":overflow:" + c.ID
+}
+
+// overflowEntry is the JSON envelope spilled into overflowKey() under
+// OverflowSpillToRedis, preserving the coalescing key alongside the
+// payload so drained entries still coalesce correctly once they're back
+// in the local queue.
+type overflowEntry struct {
+	Key     string `json:"key"`
+	Payload []byte `json:"payload"`
+}
+
+// spillOverflow persists an overflowed message to this client's Redis
+// list so it isn't lost while the local queue is full. If no Redis client
+// is configured the message is simply dropped, since that's the only
+// alternative to blocking or disconnecting.
+func (c *Client) spillOverflow(payload []byte, key string) {
+	if c.redisClient == nil {
+		c.logger.Warn("spill_to_redis policy configured with no redis client, dropping message")
+		return
+	}
+
+	data, err := json.Marshal(overflowEntry{Key: key, Payload: payload})
+	if err != nil {
+		c.logger.Error("failed to marshal overflow entry", zap.Error(err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	redisKey := c.overflowKey()
+	pipe := c.redisClient.TxPipeline()
+	pipe.RPush(ctx, redisKey, data)
+	pipe.Expire(ctx, redisKey, overflowListTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		c.logger.Warn("failed to spill outbound message to redis", zap.Error(err))
+		return
+	}
+
+	c.outbound.recordSpilled()
+}
+
+// drainOverflowLoop periodically moves spilled messages back into the
+// local outbound queue as capacity frees up, until the client closes.
+func (c *Client) drainOverflowLoop() {
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			c.drainOverflowOnce()
+		}
+	}
+}
+
+// drainOverflowOnce pulls spilled entries back into the local queue while
+// there's room, stopping as soon as the Redis list is empty or a transient
+// error occurs (the next tick will retry).
+func (c *Client) drainOverflowOnce() {
+	if c.redisClient == nil {
+		return // nothing was spilled: spillOverflow drops without a client
+	}
+	key := c.overflowKey()
+	for !c.outbound.isOverHighWatermark() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		result, err := c.redisClient.LPop(ctx, key).Result()
+		cancel()
+		if err != nil {
+			return
+		}
+
+		var entry overflowEntry
+		if err := json.Unmarshal([]byte(result), &entry); err != nil {
+			c.logger.Warn("dropping malformed spilled outbound entry", zap.Error(err))
+			continue
+		}
+
+		c.outbound.pushDirect(entry.Payload, entry.Key)
+		select {
+		case c.outboundNotify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// outboundCoalesceKey returns the outbound-coalescing key for a queued
+// payload: presence and typing updates for the same subject supersede any
+// earlier queued update instead of piling up, since only the latest state
+// matters by the time the client reads it. Every other message type (and
+// anything that fails to parse) returns "", which never coalesces.
+func outboundCoalesceKey(payload []byte) string {
+	var base protocol.BaseMessage
+	if err := json.Unmarshal(payload, &base); err != nil {
+		return ""
+	}
+
+	switch base.Type {
+	case protocol.TypeTyping:
+		var msg protocol.TypingIndicator
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			return ""
+		}
+		return "typing:" + msg.ChatID + ":" + msg.UserID
+	case protocol.TypePresence:
+		var msg protocol.PresenceUpdate
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			return ""
+		}
+		return "presence:" + msg.UserID
+	default:
+		return ""
+	}
 }
 
 // ReadPump handles incoming messages from the client
@@ -127,27 +407,28 @@ func (c *Client) ReadPump(
 		closeHandler(c)
 		c.cleanup()
 	}()
-	
-	c.Conn.SetReadLimit(1024 * 1024) // 1MB max message size
-	c.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
-	c.Conn.SetPongHandler(func(string) error {
-		c.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
-		c.metrics.LastPingTime = time.Now()
-		return nil
-	})
-	
+
+	c.transport.SetReadDeadline(time.Now().Add(60 * time.Second))
+	if pongSetter, ok := c.transport.(PongHandlerSetter); ok {
+		pongSetter.SetPongHandler(func(string) error {
+			c.transport.SetReadDeadline(time.Now().Add(60 * time.Second))
+			c.metrics.LastPingTime = time.Now()
+			return nil
+		})
+	}
+
 	for {
 		select {
 		case <-c.ctx.Done():
 			return
 		default:
-			_, message, err := c.Conn.ReadMessage()
+			message, err := c.transport.ReadMessage()
 			if err != nil {
-				if websocket.IsUnexpectedCloseError(err, 
-					websocket.CloseGoingAway, 
+				if websocket.IsUnexpectedCloseError(err,
+					websocket.CloseGoingAway,
 					websocket.CloseAbnormalClosure,
 					websocket.CloseNormalClosure) {
-					c.logger.Debug("websocket read error", zap.Error(err))
+					c.logger.Debug("transport read error", zap.Error(err))
 				}
 				return
 			}
@@ -155,7 +436,17 @@ func (c *Client) ReadPump(
 			c.LastActivity = time.Now()
 			c.metrics.MessagesReceived++
 			c.metrics.BytesReceived += int64(len(message))
-			
+
+			if c.codec.Name() != protocol.ProtocolJSON {
+				decoded, err := protocol.Transcode(message, c.codec, protocol.JSON)
+				if err != nil {
+					c.logger.Warn("dropping message that failed to decode under negotiated codec",
+						zap.String("codec", c.codec.Name()), zap.Error(err))
+					continue
+				}
+				message = decoded
+			}
+
 			// Apply rate limiting
 			if !c.RateLimiter.Allow() {
 				c.logger.Warn("rate limit exceeded",
@@ -180,7 +471,7 @@ func (c *Client) ReadPump(
 
 // WritePump handles outgoing messages to the client
 func (c *Client) WritePump() {
-	ticker := time.NewTicker(54 * time.Second) // 90% of pong wait
+	ticker := time.NewTicker(c.pingInterval)
 	defer func() {
 		ticker.Stop()
 		c.cleanup()
@@ -190,76 +481,128 @@ func (c *Client) WritePump() {
 		select {
 		case <-c.ctx.Done():
 			return
-			
-		case message, ok := <-c.Send:
-			c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			
-			if !ok {
-				// Channel closed
-				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
-				return
-			}
-			
-			w, err := c.Conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				return
-			}
-			
-			w.Write(message)
-			
-			// Drain any pending messages
-			n := len(c.Send)
-			for i := 0; i < n; i++ {
-				w.Write([]byte{'\n'})
-				w.Write(<-c.Send)
-			}
-			
-			if err := w.Close(); err != nil {
+
+		case <-c.outboundNotify:
+			if !c.flushOutbound() {
 				return
 			}
-			
+
 		case <-ticker.C:
-			c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+			c.transport.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := c.transport.Ping(); err != nil {
 				return
 			}
 		}
 	}
 }
 
+// flushOutbound writes every currently-queued payload as its own
+// transport message, returning false if the connection should be
+// abandoned (a write failed). Each payload is stored in the queue as
+// canonical JSON and transcoded to this client's negotiated codec here,
+// right before it reaches the wire.
+func (c *Client) flushOutbound() bool {
+	for {
+		payload, ok := c.outbound.pop()
+		if !ok {
+			return true
+		}
+
+		wireData, err := protocol.Transcode(payload, protocol.JSON, c.codec)
+		if err != nil {
+			c.logger.Warn("failed to transcode outbound message, sending JSON instead",
+				zap.String("codec", c.codec.Name()), zap.Error(err))
+			wireData = payload
+		}
+
+		c.applyWriteCompression(wireData)
+
+		c.transport.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		if err := c.transport.WriteMessage(TextMessage, wireData); err != nil {
+			return false
+		}
+	}
+}
+
+// applyWriteCompression toggles per-message deflate for the next write
+// and, when it applies, updates the compressed-bytes metrics. Gorilla's
+// own compressor doesn't report the size it actually puts on the wire,
+// so BytesSentCompressed is estimated by deflating a throwaway copy at
+// flate.DefaultCompression, whatever level the connection uses -- cheap
+// relative to the write itself, and close enough for a telemetry gauge.
+func (c *Client) applyWriteCompression(wireData []byte) {
+	cc, ok := c.transport.(CompressionController)
+	if !ok {
+		return
+	}
+
+	compress := c.compressionEnabled && len(wireData) >= c.compressionMinSize && !looksAlreadyCompressed(wireData)
+	cc.SetWriteCompression(compress)
+
+	if !compress {
+		return
+	}
+
+	c.metrics.BytesSentCompressed += int64(estimateDeflatedSize(wireData))
+	if c.metrics.BytesSentCompressed > 0 {
+		c.metrics.CompressionRatio = float64(c.metrics.BytesSent) / float64(c.metrics.BytesSentCompressed)
+	}
+}
+
 // Close gracefully closes the client connection
 func (c *Client) Close(reason string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	
+
 	if c.closing {
 		return
 	}
-	
+
 	c.closing = true
-	c.logger.Info("closing client connection", 
+	c.logger.Info("closing client connection",
 		zap.String("reason", reason),
 		zap.Duration("duration", time.Since(c.ConnectedAt)))
-	
+
 	c.cancel()
-	close(c.Send)
-	c.Conn.Close()
+	c.transport.Close()
 }
 
 func (c *Client) cleanup() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	
+
 	if !c.closing {
 		c.closing = true
 		c.cancel()
-		close(c.Send)
-		c.Conn.Close()
+		c.transport.Close()
+	}
+}
+
+// Feed delivers a client->server message received out of band (the SSE or
+// long-poll companion send endpoint) to ReadPump. It's a no-op error for
+// transports that read directly off a connection instead (WebSocket).
+func (c *Client) Feed(message []byte) error {
+	feeder, ok := c.transport.(InboundFeeder)
+	if !ok {
+		return errors.New("transport does not accept out-of-band input")
+	}
+	return feeder.Feed(message)
+}
+
+// PollOutbound blocks up to maxWait for queued outbound messages on
+// transports that buffer them for retrieval rather than pushing them over
+// an open connection (long-polling). The second return value reports
+// whether the transport supports polling at all.
+func (c *Client) PollOutbound(maxWait time.Duration) ([][]byte, bool) {
+	poller, ok := c.transport.(Poller)
+	if !ok {
+		return nil, false
 	}
+	return poller.Poll(maxWait), true
 }
 
 // Errors
 var (
 	ErrClientClosed = errors.New("client connection closed")
-	ErrClientSlow   = errors.New("client send channel full")
+	ErrClientSlow   = errors.New("client outbound queue exceeded its high watermark")
 )
@@ -0,0 +1,37 @@
+package connection
+
+import (
+	"bytes"
+	"compress/flate"
+)
+
+// looksAlreadyCompressed recognizes the magic bytes of the handful of
+// compressed formats a media_url payload might embed inline, so
+// flushOutbound doesn't spend CPU deflating data that's already
+// incompressible.
+func looksAlreadyCompressed(payload []byte) bool {
+	switch {
+	case len(payload) >= 2 && payload[0] == 0x1f && payload[1] == 0x8b: // gzip
+		return true
+	case len(payload) >= 2 && payload[0] == 0x78 &&
+		(payload[1] == 0x01 || payload[1] == 0x9c || payload[1] == 0xda): // zlib
+		return true
+	default:
+		return false
+	}
+}
+
+// estimateDeflatedSize reports how large payload would be after
+// deflating it at flate.DefaultCompression, without affecting what's actually
+// written to the transport (gorilla's own permessage-deflate writer
+// handles that independently once SetWriteCompression(true) is set).
+func estimateDeflatedSize(payload []byte) int {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return len(payload)
+	}
+	w.Write(payload)
+	w.Close()
+	return buf.Len()
+}
@@ -0,0 +1,306 @@
+// Package faultinject lets operators and integration tests inject
+// connection-layer chaos -- latency, drops, bandwidth caps, forced pong
+// timeouts, abrupt closes -- into live gateway connections, gated by
+// Observability.FaultInjectionEnabled so it costs nothing when unused.
+//
+// An Injector implements connection.TransportDecorator and is wired into
+// connection.Manager via SetTransportDecorator; it's also mounted as the
+// POST/GET/DELETE /debug/faults admin endpoint (see HandleDebugFaults)
+// and can replay a YAML-defined fault schedule via RunSchedule so
+// integration tests can reproduce slow-client and flaky-network behavior
+// deterministically against a real gateway instance.
+package faultinject
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+
+	"github.com/yourcompany/websocket-gateway/internal/connection"
+)
+
+var _ connection.TransportDecorator = (*Injector)(nil)
+
+// ErrInjectedDrop is returned from a faulted Transport's ReadMessage or
+// WriteMessage when a Policy's DropProbability fires, simulating a
+// flaky network link.
+var ErrInjectedDrop = errors.New("faultinject: message dropped")
+
+// LatencyDistribution describes artificial read/write latency as a mean
+// plus symmetric jitter, sampled independently on every call.
+type LatencyDistribution struct {
+	Mean   time.Duration `yaml:"mean" json:"mean"`
+	Jitter time.Duration `yaml:"jitter" json:"jitter"`
+}
+
+func (d LatencyDistribution) sample() time.Duration {
+	if d.Mean <= 0 {
+		return 0
+	}
+	if d.Jitter <= 0 {
+		return d.Mean
+	}
+	offset := time.Duration(rand.Int63n(int64(2*d.Jitter))) - d.Jitter
+	if latency := d.Mean + offset; latency > 0 {
+		return latency
+	}
+	return 0
+}
+
+// Policy is the set of faults applied to every connection a Scenario
+// matches.
+type Policy struct {
+	ReadLatency  LatencyDistribution `yaml:"read_latency" json:"read_latency"`
+	WriteLatency LatencyDistribution `yaml:"write_latency" json:"write_latency"`
+
+	// DropProbability is the chance, 0-1, that any given read or write is
+	// silently failed with ErrInjectedDrop instead of going through.
+	DropProbability float64 `yaml:"drop_probability" json:"drop_probability"`
+
+	// BandwidthCapBytesPerSec throttles writes to this many bytes/sec,
+	// bursting up to one second's worth before it starts blocking.
+	BandwidthCapBytesPerSec int `yaml:"bandwidth_cap_bytes_per_sec" json:"bandwidth_cap_bytes_per_sec"`
+
+	// ForcePongTimeout makes Ping report success locally without ever
+	// reaching the peer, so the real pong never arrives and the normal
+	// pong-wait deadline disconnects the client -- reproducing a client
+	// that's stopped responding without actually dropping the socket.
+	ForcePongTimeout bool `yaml:"force_pong_timeout" json:"force_pong_timeout"`
+
+	// AbruptCloseAfter, once elapsed since the connection was wrapped,
+	// makes every subsequent read/write fail as if the peer vanished
+	// mid-stream (an abnormal closure) rather than closing cleanly.
+	AbruptCloseAfter time.Duration `yaml:"abrupt_close_after" json:"abrupt_close_after"`
+}
+
+// Scenario selects which connections a Policy applies to and for how
+// long. ShardID and ClientIDPrefix are both optional; an unset ShardID
+// matches every shard and an empty ClientIDPrefix matches every client.
+type Scenario struct {
+	Name           string  `yaml:"name" json:"name"`
+	ShardID        *uint32 `yaml:"shard_id" json:"shard_id"`
+	ClientIDPrefix string  `yaml:"client_id_prefix" json:"client_id_prefix"`
+
+	// Percentage, 0-100, is the fraction of matching connections this
+	// scenario actually affects, e.g. "50% of connections on shard 3".
+	Percentage float64 `yaml:"percentage" json:"percentage"`
+
+	// Duration bounds how long the scenario stays active after it's
+	// added; zero means it stays active until explicitly cleared.
+	Duration time.Duration `yaml:"duration" json:"duration"`
+
+	Policy Policy `yaml:"policy" json:"policy"`
+
+	expiresAt time.Time
+}
+
+func (s *Scenario) matches(clientID string, shardID uint32) bool {
+	if s.ShardID != nil && *s.ShardID != shardID {
+		return false
+	}
+	if s.ClientIDPrefix != "" && !strings.HasPrefix(clientID, s.ClientIDPrefix) {
+		return false
+	}
+	if s.Percentage <= 0 {
+		return false
+	}
+	if s.Percentage >= 100 {
+		return true
+	}
+	return rand.Float64()*100 < s.Percentage
+}
+
+// Injector holds the currently active scenarios and decorates every
+// connection that matches one of them with the corresponding Policy.
+type Injector struct {
+	mu        sync.Mutex
+	scenarios []*Scenario
+
+	logger *zap.Logger
+}
+
+// NewInjector creates an Injector with no active scenarios.
+func NewInjector(logger *zap.Logger) *Injector {
+	return &Injector{logger: logger}
+}
+
+// Decorate implements connection.TransportDecorator: it wraps transport
+// with the Policy of the first active scenario that matches clientID and
+// shardID, or returns transport unwrapped if none do.
+func (inj *Injector) Decorate(transport connection.Transport, clientID string, shardID uint32) connection.Transport {
+	inj.mu.Lock()
+	defer inj.mu.Unlock()
+
+	inj.expireLocked()
+
+	for _, s := range inj.scenarios {
+		if s.matches(clientID, shardID) {
+			inj.logger.Info("fault injection: wrapping connection",
+				zap.String("scenario", s.Name),
+				zap.String("client_id", clientID),
+				zap.Uint32("shard_id", shardID))
+			return wrap(transport, s.Policy)
+		}
+	}
+
+	return transport
+}
+
+// expireLocked drops scenarios whose Duration has elapsed. Must be called
+// with mu held.
+func (inj *Injector) expireLocked() {
+	live := inj.scenarios[:0]
+	for _, s := range inj.scenarios {
+		if s.expiresAt.IsZero() || time.Now().Before(s.expiresAt) {
+			live = append(live, s)
+		}
+	}
+	inj.scenarios = live
+}
+
+// AddScenario activates s, starting its Duration countdown (if any) from
+// now. Only connections established after this call are affected --
+// already-wrapped connections keep whatever Policy they were decorated
+// with.
+func (inj *Injector) AddScenario(s *Scenario) {
+	inj.mu.Lock()
+	defer inj.mu.Unlock()
+
+	if s.Duration > 0 {
+		s.expiresAt = time.Now().Add(s.Duration)
+	}
+	inj.scenarios = append(inj.scenarios, s)
+}
+
+// ClearScenarios deactivates every currently active scenario.
+func (inj *Injector) ClearScenarios() {
+	inj.mu.Lock()
+	defer inj.mu.Unlock()
+	inj.scenarios = nil
+}
+
+// Scenarios returns a snapshot of the currently active scenarios.
+func (inj *Injector) Scenarios() []*Scenario {
+	inj.mu.Lock()
+	defer inj.mu.Unlock()
+
+	inj.expireLocked()
+	return append([]*Scenario{}, inj.scenarios...)
+}
+
+// HandleDebugFaults implements the admin API: POST adds a scenario (the
+// request body is a single Scenario, the same shape RunSchedule loads
+// from YAML), GET lists the active ones, and DELETE clears all of them.
+func (inj *Injector) HandleDebugFaults(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		var s Scenario
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+			http.Error(w, fmt.Sprintf("invalid scenario: %v", err), http.StatusBadRequest)
+			return
+		}
+		inj.AddScenario(&s)
+		w.WriteHeader(http.StatusAccepted)
+
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(inj.Scenarios())
+
+	case http.MethodDelete:
+		inj.ClearScenarios()
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Schedule is a YAML-defined sequence of scenario activations, replayed
+// by RunSchedule so an integration test can reproduce a specific fault
+// pattern deterministically instead of racing real timers by hand.
+type Schedule struct {
+	Steps []ScheduleStep `yaml:"steps"`
+}
+
+// ScheduleStep activates Scenario after waiting After since the previous
+// step (or since RunSchedule started, for the first step).
+type ScheduleStep struct {
+	After    time.Duration `yaml:"after"`
+	Scenario Scenario      `yaml:"scenario"`
+}
+
+// LoadSchedule parses a YAML-defined fault schedule, e.g.:
+//
+//	steps:
+//	  - after: 0s
+//	    scenario:
+//	      name: slow-shard-3
+//	      shard_id: 3
+//	      percentage: 50
+//	      duration: 60s
+//	      policy:
+//	        write_latency: {mean: 200ms}
+func LoadSchedule(data []byte) (*Schedule, error) {
+	var sched Schedule
+	if err := yaml.Unmarshal(data, &sched); err != nil {
+		return nil, fmt.Errorf("faultinject: parsing schedule: %w", err)
+	}
+	return &sched, nil
+}
+
+// RunSchedule activates each step's scenario in order, waiting After
+// between steps, until every step has run or ctx is canceled.
+func (inj *Injector) RunSchedule(ctx context.Context, sched *Schedule) error {
+	for i, step := range sched.Steps {
+		if step.After > 0 {
+			timer := time.NewTimer(step.After)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+
+		scenario := step.Scenario
+		inj.logger.Info("fault schedule: activating step",
+			zap.Int("step", i), zap.String("scenario", scenario.Name))
+		inj.AddScenario(&scenario)
+	}
+
+	return nil
+}
+
+// wrap picks the narrowest faultTransport variant that preserves
+// whichever optional capability interfaces (connection.PongHandlerSetter,
+// connection.InboundFeeder, connection.Poller) inner actually implements,
+// so e.g. ReadPump's type assertion for a pong handler still succeeds on
+// a wrapped WebSocketTransport.
+func wrap(inner connection.Transport, policy Policy) connection.Transport {
+	base := newFaultTransport(inner, policy)
+
+	_, hasPoller := inner.(connection.Poller)
+	_, hasFeeder := inner.(connection.InboundFeeder)
+	_, hasPong := inner.(connection.PongHandlerSetter)
+
+	switch {
+	case hasFeeder && hasPoller:
+		return &faultTransportWithFeederAndPoller{base}
+	case hasFeeder:
+		return &faultTransportWithFeeder{base}
+	case hasPong:
+		return &faultTransportWithPong{base}
+	default:
+		return base
+	}
+}
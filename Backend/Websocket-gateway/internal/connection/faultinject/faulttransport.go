@@ -0,0 +1,136 @@
+package faultinject
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/yourcompany/websocket-gateway/internal/connection"
+)
+
+// faultTransport wraps a connection.Transport, applying a fixed Policy to
+// every read and write. It's built once per connection, at Decorate
+// time, and never mutated afterward, so reads of policy need no locking.
+type faultTransport struct {
+	inner  connection.Transport
+	policy Policy
+
+	limiter  *rate.Limiter
+	abruptAt time.Time
+}
+
+func newFaultTransport(inner connection.Transport, policy Policy) *faultTransport {
+	ft := &faultTransport{inner: inner, policy: policy}
+
+	if policy.BandwidthCapBytesPerSec > 0 {
+		ft.limiter = rate.NewLimiter(rate.Limit(policy.BandwidthCapBytesPerSec), policy.BandwidthCapBytesPerSec)
+	}
+	if policy.AbruptCloseAfter > 0 {
+		ft.abruptAt = time.Now().Add(policy.AbruptCloseAfter)
+	}
+
+	return ft
+}
+
+func (ft *faultTransport) abruptlyClosed() bool {
+	return !ft.abruptAt.IsZero() && time.Now().After(ft.abruptAt)
+}
+
+func (ft *faultTransport) ReadMessage() ([]byte, error) {
+	if ft.abruptlyClosed() {
+		return nil, connection.ErrTransportClosed
+	}
+
+	payload, err := ft.inner.ReadMessage()
+	if err != nil {
+		return payload, err
+	}
+
+	if delay := ft.policy.ReadLatency.sample(); delay > 0 {
+		time.Sleep(delay)
+	}
+	if ft.policy.DropProbability > 0 && rand.Float64() < ft.policy.DropProbability {
+		return nil, ErrInjectedDrop
+	}
+
+	return payload, nil
+}
+
+func (ft *faultTransport) WriteMessage(messageType int, payload []byte) error {
+	if ft.abruptlyClosed() {
+		return connection.ErrTransportClosed
+	}
+
+	if ft.policy.DropProbability > 0 && rand.Float64() < ft.policy.DropProbability {
+		return ErrInjectedDrop
+	}
+	if delay := ft.policy.WriteLatency.sample(); delay > 0 {
+		time.Sleep(delay)
+	}
+	if ft.limiter != nil {
+		if err := ft.limiter.WaitN(context.Background(), len(payload)); err != nil {
+			return err
+		}
+	}
+
+	return ft.inner.WriteMessage(messageType, payload)
+}
+
+func (ft *faultTransport) Ping() error {
+	if ft.policy.ForcePongTimeout {
+		// Report success without ever reaching the peer, so the real pong
+		// never arrives and the normal pong-wait deadline disconnects the
+		// client -- as if it had quietly stopped responding.
+		return nil
+	}
+	return ft.inner.Ping()
+}
+
+func (ft *faultTransport) Close() error {
+	return ft.inner.Close()
+}
+
+func (ft *faultTransport) SetReadDeadline(t time.Time) error {
+	return ft.inner.SetReadDeadline(t)
+}
+
+func (ft *faultTransport) SetWriteDeadline(t time.Time) error {
+	return ft.inner.SetWriteDeadline(t)
+}
+
+// faultTransportWithPong adds connection.PongHandlerSetter for a wrapped
+// transport that supports it (WebSocket).
+type faultTransportWithPong struct {
+	*faultTransport
+}
+
+func (f *faultTransportWithPong) SetPongHandler(handler func(appData string) error) {
+	f.inner.(connection.PongHandlerSetter).SetPongHandler(handler)
+}
+
+// faultTransportWithFeeder adds connection.InboundFeeder for a wrapped
+// transport that supports it (SSE).
+type faultTransportWithFeeder struct {
+	*faultTransport
+}
+
+func (f *faultTransportWithFeeder) Feed(message []byte) error {
+	return f.inner.(connection.InboundFeeder).Feed(message)
+}
+
+// faultTransportWithFeederAndPoller adds both connection.InboundFeeder
+// and connection.Poller for a wrapped transport that supports both
+// (long-poll).
+type faultTransportWithFeederAndPoller struct {
+	*faultTransport
+}
+
+func (f *faultTransportWithFeederAndPoller) Feed(message []byte) error {
+	return f.inner.(connection.InboundFeeder).Feed(message)
+}
+
+func (f *faultTransportWithFeederAndPoller) Poll(maxWait time.Duration) [][]byte {
+	return f.inner.(connection.Poller).Poll(maxWait)
+}
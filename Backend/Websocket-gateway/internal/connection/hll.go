@@ -0,0 +1,137 @@
+package connection
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// hllPrecision controls the register count (2^precision), trading memory
+// for accuracy: 14 bits -> 16384 registers (~16KB) and <1% typical error.
+const hllPrecision = 14
+
+const hllRegisterCount = 1 << hllPrecision
+
+// hll is a small HyperLogLog++-style cardinality sketch used to estimate
+// distinct active users without keeping a per-user set in memory.
+type hll struct {
+	registers [hllRegisterCount]uint8
+}
+
+func newHLL() *hll {
+	return &hll{}
+}
+
+func (h *hll) add(key string) {
+	hasher := fnv.New64a()
+	hasher.Write([]byte(key))
+	sum := hasher.Sum64()
+
+	idx := sum >> (64 - hllPrecision)
+	rest := sum<<hllPrecision | (1 << (hllPrecision - 1)) // sentinel bit in the shifted-in zeros so rest != 0
+	rank := uint8(bits.LeadingZeros64(rest) + 1)
+
+	if rank > h.registers[idx] {
+		h.registers[idx] = rank
+	}
+}
+
+func (h *hll) merge(other *hll) {
+	for i, r := range other.registers {
+		if r > h.registers[i] {
+			h.registers[i] = r
+		}
+	}
+}
+
+// count returns the estimated cardinality using the standard HLL
+// estimator with the small-range (linear counting) correction; no
+// large-range correction is applied.
+func (h *hll) count() uint64 {
+	m := float64(hllRegisterCount)
+
+	sum := 0.0
+	zeros := 0
+	for _, r := range h.registers {
+		sum += 1.0 / math.Pow(2, float64(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+
+	if estimate <= 2.5*m && zeros > 0 {
+		return uint64(m * math.Log(m/float64(zeros)))
+	}
+	return uint64(estimate)
+}
+
+// windowedHLL approximates a sliding-window distinct count by keeping a
+// ring of smaller HLL buckets and merging the live ones, so old entries
+// age out without requiring a full reset of the window.
+type windowedHLL struct {
+	mu             sync.Mutex
+	buckets        []*hll
+	bucketStarts   []time.Time
+	bucketDuration time.Duration
+	cursor         int
+}
+
+func newWindowedHLL(bucketCount int, bucketDuration time.Duration) *windowedHLL {
+	w := &windowedHLL{
+		buckets:        make([]*hll, bucketCount),
+		bucketStarts:   make([]time.Time, bucketCount),
+		bucketDuration: bucketDuration,
+	}
+	now := time.Now()
+	for i := range w.buckets {
+		w.buckets[i] = newHLL()
+		w.bucketStarts[i] = now
+	}
+	return w
+}
+
+// add records key as active "now", advancing the ring past any buckets
+// that have aged out of the window.
+func (w *windowedHLL) add(key string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.advanceLocked(time.Now())
+	w.buckets[w.cursor].add(key)
+}
+
+// advanceLocked rotates the cursor forward one bucket per bucketDuration
+// elapsed since the current bucket was started, clearing each bucket it
+// moves onto.
+func (w *windowedHLL) advanceLocked(now time.Time) {
+	if now.Sub(w.bucketStarts[w.cursor]) < w.bucketDuration {
+		return
+	}
+
+	elapsedSlots := int(now.Sub(w.bucketStarts[w.cursor]) / w.bucketDuration)
+	for i := 0; i < elapsedSlots && i < len(w.buckets); i++ {
+		w.cursor = (w.cursor + 1) % len(w.buckets)
+		w.buckets[w.cursor] = newHLL()
+		w.bucketStarts[w.cursor] = now
+	}
+}
+
+// count merges every bucket still within the window and returns the
+// estimated distinct key count.
+func (w *windowedHLL) count() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.advanceLocked(time.Now())
+
+	merged := newHLL()
+	for _, b := range w.buckets {
+		merged.merge(b)
+	}
+	return merged.count()
+}
@@ -2,16 +2,19 @@ package connection
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"hash/fnv"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 	"golang.org/x/time/rate"
 
 	"github.com/yourcompany/websocket-gateway/internal/config"
+	"github.com/yourcompany/websocket-gateway/pkg/protocol"
 )
 
 // Manager manages all WebSocket connections
@@ -39,6 +42,157 @@ type Manager struct {
 	onConnect    func(*Client)
 	onDisconnect func(*Client, string)
 	onMessage    func(*Client, []byte) error
+
+	// Optional offline fallback, e.g. Web Push
+	pushFallback PushFallback
+
+	// Optional reconnect backlog replay
+	backlogReplayer BacklogReplayer
+
+	// Optional outbound-queue telemetry, e.g. metrics.MetricsCollector
+	outboundMetrics OutboundMetricsRecorder
+
+	// Redis client used to spill outbound messages for clients whose
+	// overflow policy is OverflowSpillToRedis. Left nil when no shared
+	// client has been wired in, in which case spilling is skipped.
+	outboundRedis redis.UniversalClient
+
+	// Optional chaos-testing hook wrapping every newly established
+	// Transport. Left nil (no wrapping) unless fault injection is enabled.
+	transportDecorator TransportDecorator
+
+	// Optional cluster-wide ownership registry, e.g. internal/cluster.Registry.
+	clusterRegistry ClusterRegistry
+
+	// Optional presence/typing tracker, e.g. internal/presence.Manager.
+	presenceNotifier PresenceNotifier
+
+	// presenceSubs tracks the one SubscribeToUser subscription per userID
+	// that forwards presence updates back out to that user's own
+	// connected devices on this node, so a status change is reflected on
+	// the user's other sessions without fanning a subscription out per
+	// device. Keyed by userID, guarded by presenceSubsMu.
+	presenceSubsMu sync.Mutex
+	presenceSubs   map[string]func()
+
+	// Optional hot-reload manager owning the fields in config that Reload
+	// mutates in place. When set, reads of those fields that race with a
+	// possible concurrent Reload go through its lock-protected Get()
+	// instead of reading m.config directly.
+	configManager *config.Manager
+
+	// Distinct-active-user sketches for capacity planning gauges
+	activeUsers1h  *windowedHLL
+	activeUsers24h *windowedHLL
+}
+
+// BacklogReplayer replays buffered messages to a client that reconnected
+// with a last_message_id cursor. Implemented by internal/backlog.Manager.
+type BacklogReplayer interface {
+	Append(ctx context.Context, userID, messageID string, payload []byte)
+	Replay(ctx context.Context, userID string, afterSeq uint64, deliver func(seq uint64, payload []byte) bool) error
+}
+
+// SetBacklogReplayer registers the handler used to replay missed
+// messages after a reconnecting client authenticates with a
+// last_message_id cursor, and to record messages as they're sent.
+func (m *Manager) SetBacklogReplayer(br BacklogReplayer) {
+	m.backlogReplayer = br
+}
+
+// PushFallback delivers a message to a user who has no active WebSocket
+// clients on any shard. Implemented by internal/webpush.Manager.
+type PushFallback interface {
+	SendPush(ctx context.Context, userID string, payload []byte) error
+}
+
+// SetPushFallback registers the handler invoked when SendToUser finds no
+// connected clients for a user.
+func (m *Manager) SetPushFallback(pf PushFallback) {
+	m.pushFallback = pf
+}
+
+// TransportDecorator optionally wraps a newly established Transport
+// before its Client is constructed from it, e.g. to inject artificial
+// latency, drops, or forced disconnects for chaos testing. Implemented by
+// connection/faultinject.Injector and wired in via
+// Manager.SetTransportDecorator; nil (the default) means connections are
+// never wrapped.
+type TransportDecorator interface {
+	Decorate(transport Transport, clientID string, shardID uint32) Transport
+}
+
+// SetTransportDecorator registers the decorator used to wrap every newly
+// established Transport before its Client is created.
+func (m *Manager) SetTransportDecorator(d TransportDecorator) {
+	m.transportDecorator = d
+}
+
+// ClusterRegistry tracks, cluster-wide, which node owns each connected
+// user's devices. SendToUser consults Owner only to tell a user with no
+// locally-connected clients who is connected to a different node apart
+// from one who is offline, so push fallback isn't fired for the former;
+// messages are not routed to the owning node through it. Implemented by
+// internal/cluster.Registry.
+type ClusterRegistry interface {
+	Attach(ctx context.Context, userID, deviceID string, shardID uint32) error
+	Detach(ctx context.Context, userID, deviceID string) error
+	Owner(userID string) (nodeID string, ok bool)
+}
+
+// SetClusterRegistry registers the registry used to propose attach/detach
+// entries as clients authenticate and disconnect, and to look up which
+// node owns a user before falling back to offline delivery.
+func (m *Manager) SetClusterRegistry(cr ClusterRegistry) {
+	m.clusterRegistry = cr
+}
+
+// PresenceNotifier tracks per-device online/offline state and fans out
+// the resulting aggregate status change to subscribers, across nodes.
+// Implemented by internal/presence.Manager.
+type PresenceNotifier interface {
+	DeviceConnected(userID, deviceID string)
+	DeviceDisconnected(userID, deviceID string)
+	SubscribeToUser(userID string, handler func(protocol.PresenceUpdate)) func()
+}
+
+// SetPresenceNotifier registers the tracker notified as clients
+// authenticate and disconnect, and used to deliver presence updates back
+// to a user's own connected devices.
+func (m *Manager) SetPresenceNotifier(pn PresenceNotifier) {
+	m.presenceNotifier = pn
+}
+
+// SetOutboundMetricsRecorder registers the recorder used to report each
+// client's outbound queue depth, drops and coalescing events.
+func (m *Manager) SetOutboundMetricsRecorder(recorder OutboundMetricsRecorder) {
+	m.outboundMetrics = recorder
+}
+
+// SetConfigManager registers the hot-reload manager to read safely-reloadable
+// config fields through, instead of racing Reload's in-place mutation of the
+// shared *Config.
+func (m *Manager) SetConfigManager(cm *config.Manager) {
+	m.configManager = cm
+}
+
+// liveConfig returns a consistent, race-free snapshot of config fields
+// Reload can mutate concurrently, falling back to the shared *Config
+// directly if no config.Manager has been wired in (e.g. in tests).
+func (m *Manager) liveConfig() *config.Config {
+	if m.configManager == nil {
+		return m.config
+	}
+	cfg := m.configManager.Get()
+	return &cfg
+}
+
+// SetOutboundRedisClient registers the shared Redis client used to spill
+// overflow messages for clients whose outbound policy is
+// OverflowSpillToRedis. Without it, that policy falls back to dropping
+// spilled messages since there's nowhere to put them.
+func (m *Manager) SetOutboundRedisClient(client redis.UniversalClient) {
+	m.outboundRedis = client
 }
 
 // NewManager creates a new connection manager
@@ -60,6 +214,11 @@ func NewManager(cfg *config.Config, logger *zap.Logger) *Manager {
 		config:     cfg,
 		logger:     logger,
 		maxConns:   int64(cfg.RateLimit.GlobalConnections),
+
+		activeUsers1h:  newWindowedHLL(60, time.Minute),    // 60x1m buckets = 1h window
+		activeUsers24h: newWindowedHLL(24, time.Hour),      // 24x1h buckets = 24h window
+
+		presenceSubs: make(map[string]func()),
 	}
 	
 	// Initialize shards
@@ -97,12 +256,16 @@ func (m *Manager) RegisterHandlers(
 	m.onMessage = onMessage
 }
 
-// AddConnection adds a new WebSocket connection
+// AddConnection adds a new connection over the given transport (WebSocket,
+// SSE, or long-poll). codec is the wire codec negotiated for this
+// connection (protocol.JSON for transports, like SSE and long-poll, that
+// don't negotiate a Sec-WebSocket-Protocol).
 func (m *Manager) AddConnection(
-	conn *websocket.Conn,
+	transport Transport,
 	ip string,
 	rateLimit rate.Limit,
 	burst int,
+	codec protocol.Codec,
 ) (*Client, error) {
 	// Check global connection limit
 	if atomic.LoadInt64(&m.globalConns) >= m.maxConns {
@@ -121,8 +284,37 @@ func (m *Manager) AddConnection(
 	shardID := m.getShardID(clientID)
 	shard := m.shards[shardID]
 	
-	// Create client
-	client := NewClient(conn, clientID, ip, shardID, rateLimit, burst, m.logger)
+	// Snapshot safely-reloadable fields once, rather than reading
+	// m.config directly: Reload mutates them in place on a separate
+	// goroutine and this runs concurrently with every new connection.
+	cfg := m.liveConfig()
+
+	// Create client. SSE gets its own keepalive cadence since its
+	// idle-timeout characteristics (proxies, browsers) differ from a raw
+	// WebSocket's pong wait; every other transport uses the default.
+	pingInterval := time.Duration(0)
+	if _, ok := transport.(*SSETransport); ok {
+		pingInterval = cfg.Server.SSEKeepaliveInterval
+	}
+
+	if m.transportDecorator != nil {
+		transport = m.transportDecorator.Decorate(transport, clientID, shardID)
+	}
+
+	client := NewClient(transport, clientID, ip, shardID, rateLimit, burst,
+		cfg.Server.OutboundQueueHighWatermark,
+		cfg.Server.OutboundQueueLowWatermark,
+		OverflowPolicy(cfg.Server.OutboundOverflowPolicy),
+		cfg.Server.SlowClientTimeout,
+		pingInterval,
+		cfg.RateLimit.BackpressureBlockTimeout,
+		m.outboundRedis,
+		m.config.Redis.PubSubChannelPrefix,
+		m.outboundMetrics,
+		codec,
+		m.config.Server.EnablePermessageDeflate,
+		m.config.Server.CompressionMinSize,
+		m.logger)
 	
 	// Add to shard
 	shard.AddClient(client)
@@ -144,7 +336,15 @@ func (m *Manager) AddConnection(
 		defer m.wg.Done()
 		client.WritePump()
 	}()
-	
+
+	if OverflowPolicy(cfg.Server.OutboundOverflowPolicy) == OverflowSpillToRedis {
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			client.drainOverflowLoop()
+		}()
+	}
+
 	// Call connect handler
 	if m.onConnect != nil {
 		m.onConnect(client)
@@ -153,31 +353,107 @@ func (m *Manager) AddConnection(
 	return client, nil
 }
 
-// AuthenticateClient authenticates a client
-func (m *Manager) AuthenticateClient(clientID, userID, deviceID string) error {
+// AuthenticateClient authenticates a client. If lastMessageID is non-nil
+// and a backlog replayer is configured, any buffered messages with a
+// higher sequence are replayed to the client before this call returns.
+func (m *Manager) AuthenticateClient(clientID, userID, deviceID string, lastMessageID *uint64) error {
 	shardID := m.getShardID(clientID)
 	shard := m.shards[shardID]
-	
+
 	client := shard.GetClient(clientID)
 	if client == nil {
 		return fmt.Errorf("client not found")
 	}
-	
+
 	// Check user connection limit
 	if !m.userLimiter.Allow(userID) {
 		return fmt.Errorf("user connection limit exceeded")
 	}
-	
+
 	shard.RegisterAuthenticatedClient(client, userID, deviceID)
-	
+	m.activeUsers1h.add(userID)
+	m.activeUsers24h.add(userID)
+
 	m.logger.Info("client authenticated",
 		zap.String("client_id", clientID),
 		zap.String("user_id", userID),
 		zap.String("device_id", deviceID))
-	
+
+	if m.clusterRegistry != nil {
+		if err := m.clusterRegistry.Attach(context.Background(), userID, deviceID, shardID); err != nil {
+			m.logger.Warn("failed to propose cluster attach",
+				zap.String("user_id", userID), zap.String("device_id", deviceID), zap.Error(err))
+		}
+	}
+
+	if lastMessageID != nil && m.backlogReplayer != nil {
+		m.replayBacklog(client, userID, *lastMessageID)
+	}
+
+	if m.presenceNotifier != nil {
+		m.presenceNotifier.DeviceConnected(userID, deviceID)
+		m.ensurePresenceSubscription(userID)
+	}
+
 	return nil
 }
 
+// ensurePresenceSubscription subscribes this node to userID's presence
+// updates the first time one of userID's devices connects here, forwarding
+// every update to all of userID's locally-connected devices via SendToUser
+// so, e.g., a second device coming online is reflected on the first.
+func (m *Manager) ensurePresenceSubscription(userID string) {
+	m.presenceSubsMu.Lock()
+	defer m.presenceSubsMu.Unlock()
+
+	if _, ok := m.presenceSubs[userID]; ok {
+		return
+	}
+
+	m.presenceSubs[userID] = m.presenceNotifier.SubscribeToUser(userID, func(update protocol.PresenceUpdate) {
+		payload, err := json.Marshal(update)
+		if err != nil {
+			m.logger.Warn("failed to marshal presence update", zap.String("user_id", userID), zap.Error(err))
+			return
+		}
+		if _, err := m.SendToUser(userID, payload); err != nil {
+			m.logger.Warn("failed to deliver presence update", zap.String("user_id", userID), zap.Error(err))
+		}
+	})
+}
+
+// teardownPresenceSubscriptionIfIdle unsubscribes from userID's presence
+// updates once none of its devices are connected to this node anymore.
+func (m *Manager) teardownPresenceSubscriptionIfIdle(userID string) {
+	if len(m.GetUserClients(userID)) > 0 {
+		return
+	}
+
+	m.presenceSubsMu.Lock()
+	defer m.presenceSubsMu.Unlock()
+
+	if unsubscribe, ok := m.presenceSubs[userID]; ok {
+		unsubscribe()
+		delete(m.presenceSubs, userID)
+	}
+}
+
+// replayBacklog delivers buffered messages to a reconnecting client,
+// skipping any that are no longer writable (client went slow/closed
+// mid-replay) rather than blocking indefinitely.
+func (m *Manager) replayBacklog(client *Client, userID string, lastMessageID uint64) {
+	err := m.backlogReplayer.Replay(context.Background(), userID, lastMessageID,
+		func(seq uint64, payload []byte) bool {
+			return client.WriteMessage(payload) == nil
+		})
+	if err != nil {
+		m.logger.Warn("backlog replay failed",
+			zap.String("user_id", userID),
+			zap.String("client_id", client.ID),
+			zap.Error(err))
+	}
+}
+
 // SendToClient sends a message to a specific client
 func (m *Manager) SendToClient(clientID string, message []byte) error {
 	shardID := m.getShardID(clientID)
@@ -191,17 +467,50 @@ func (m *Manager) SendToClient(clientID string, message []byte) error {
 	return client.WriteMessage(message)
 }
 
-// SendToUser sends a message to all devices of a user
+// SendToUser sends a message to all devices of a user connected to this
+// node. If the user has no active clients on any shard and a push
+// fallback is configured, the message is handed off for offline delivery
+// (e.g. Web Push) instead -- unless a cluster registry shows the user is
+// connected to a different node, in which case it's that node's job to
+// decide on push fallback and this node leaves it alone. This does not
+// route the message itself to the owning node; that still relies on
+// whatever broadcasts this call cluster-wide.
 func (m *Manager) SendToUser(userID string, message []byte) (int, error) {
 	totalSent := 0
-	
+	m.activeUsers1h.add(userID)
+	m.activeUsers24h.add(userID)
+
 	// Iterate through all shards (user might be connected to multiple shards)
 	for _, shard := range m.shards {
 		if sent, err := shard.BroadcastToUser(userID, message); err == nil {
 			totalSent += sent
 		}
 	}
-	
+
+	if m.backlogReplayer != nil {
+		var base protocol.BaseMessage
+		if err := json.Unmarshal(message, &base); err == nil && base.MessageID != "" {
+			m.backlogReplayer.Append(context.Background(), userID, base.MessageID, message)
+		}
+	}
+
+	if totalSent == 0 && m.clusterRegistry != nil {
+		if nodeID, ok := m.clusterRegistry.Owner(userID); ok && nodeID != m.config.Cluster.NodeID {
+			return 0, nil
+		}
+	}
+
+	if totalSent == 0 && m.pushFallback != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := m.pushFallback.SendPush(ctx, userID, message); err != nil {
+			m.logger.Warn("push fallback delivery failed",
+				zap.String("user_id", userID),
+				zap.Error(err))
+		}
+	}
+
 	return totalSent, nil
 }
 
@@ -223,6 +532,18 @@ func (m *Manager) GetUserClients(userID string) []*Client {
 	return allClients
 }
 
+// RebuildRateLimiters applies a new per-client rate and burst to every
+// currently connected client on every shard, so a config reload changes
+// the limit already-connected clients are held to, not just the ones
+// negotiated for new connections going forward.
+func (m *Manager) RebuildRateLimiters(messagesPerSecond rate.Limit, burst int) {
+	for _, shard := range m.shards {
+		shard.ForEachClient(func(client *Client) {
+			client.RebuildRateLimiter(messagesPerSecond, burst)
+		})
+	}
+}
+
 // RemoveClient removes a client
 func (m *Manager) RemoveClient(clientID, reason string) {
 	shardID := m.getShardID(clientID)
@@ -232,7 +553,19 @@ func (m *Manager) RemoveClient(clientID, reason string) {
 	if client != nil {
 		atomic.AddInt64(&m.globalConns, -1)
 		client.Close(reason)
-		
+
+		if m.clusterRegistry != nil && client.UserID != "" {
+			if err := m.clusterRegistry.Detach(context.Background(), client.UserID, client.DeviceID); err != nil {
+				m.logger.Warn("failed to propose cluster detach",
+					zap.String("user_id", client.UserID), zap.String("device_id", client.DeviceID), zap.Error(err))
+			}
+		}
+
+		if m.presenceNotifier != nil && client.UserID != "" {
+			m.presenceNotifier.DeviceDisconnected(client.UserID, client.DeviceID)
+			m.teardownPresenceSubscriptionIfIdle(client.UserID)
+		}
+
 		// Call disconnect handler
 		if m.onDisconnect != nil {
 			m.onDisconnect(client, reason)
@@ -274,6 +607,13 @@ func (m *Manager) GetStats() map[uint32]ShardStats {
 	return stats
 }
 
+// ActiveUserCounts returns the estimated distinct active-user counts over
+// the trailing hour and day, for the metrics package's capacity-planning
+// gauges.
+func (m *Manager) ActiveUserCounts() (last1h, last24h uint64) {
+	return m.activeUsers1h.count(), m.activeUsers24h.count()
+}
+
 // Shutdown gracefully shuts down the connection manager
 func (m *Manager) Shutdown() {
 	m.logger.Info("shutting down connection manager")
@@ -308,7 +648,7 @@ func (m *Manager) startCleanupRoutine() {
 }
 
 func (m *Manager) cleanupInactiveConnections() {
-	timeout := m.config.Server.PongWait * 2
+	timeout := m.liveConfig().Server.PongWait * 2
 	
 	for _, shard := range m.shards {
 		removed := shard.CleanupInactive(timeout)
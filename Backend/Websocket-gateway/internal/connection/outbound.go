@@ -0,0 +1,275 @@
+package connection
+
+import (
+	"sync"
+	"time"
+)
+
+// OverflowPolicy controls what an outboundQueue does once a client's
+// outbound backlog crosses its high watermark.
+type OverflowPolicy string
+
+const (
+	// OverflowDropOldest evicts the oldest queued message to make room.
+	OverflowDropOldest OverflowPolicy = "drop_oldest"
+	// OverflowDropNewest discards the message that would have overflowed
+	// the queue, leaving everything already queued untouched.
+	OverflowDropNewest OverflowPolicy = "drop_newest"
+	// OverflowDisconnect lets the queue keep growing and disconnects the
+	// client once it's stayed above the watermark for longer than its
+	// slow-client timeout.
+	OverflowDisconnect OverflowPolicy = "disconnect"
+	// OverflowBlockWithTimeout makes WriteMessage block the calling
+	// goroutine until the queue drains back under its high watermark, up
+	// to a configured timeout, disconnecting the client if it never does.
+	OverflowBlockWithTimeout OverflowPolicy = "block_with_timeout"
+	// OverflowSpillToRedis pushes overflow messages onto a per-client
+	// Redis list instead of dropping or blocking, draining them back into
+	// the local queue as capacity frees up.
+	OverflowSpillToRedis OverflowPolicy = "spill_to_redis"
+)
+
+// OutboundMetricsRecorder receives telemetry from every client's outbound
+// queue. It's defined here rather than imported from internal/metrics
+// because metrics already imports connection; implemented by
+// metrics.MetricsCollector and wired in via Manager.SetOutboundMetricsRecorder.
+type OutboundMetricsRecorder interface {
+	ObserveOutboundQueueDepth(depth int)
+	RecordOutboundDropped()
+	RecordOutboundCoalesced()
+	RecordOutboundSpilled()
+	RecordOutboundBlockTimeout()
+}
+
+// outboundPushOutcome tells WriteMessage what, if anything, it needs to do
+// beyond what push already did to the local queue.
+type outboundPushOutcome int
+
+const (
+	outboundPushed     outboundPushOutcome = iota // queued locally (or coalesced), nothing further to do
+	outboundDropped                               // discarded under drop_newest, nothing further to do
+	outboundSpill                                 // caller must spill payload to Redis itself
+	outboundDisconnect                            // caller must disconnect the client
+)
+
+type outboundEntry struct {
+	key     string
+	payload []byte
+}
+
+// outboundQueue is a bounded, coalescing FIFO of outbound payloads for a
+// single Client. Consecutive pushes that share a non-empty key (presence
+// and typing updates for the same subject) replace the previously queued
+// entry instead of piling up, since only the latest state matters by the
+// time WritePump gets around to sending it.
+type outboundQueue struct {
+	mu       sync.Mutex
+	entries  []*outboundEntry
+	keyIndex map[string]*outboundEntry
+
+	highWatermark int
+	lowWatermark  int
+	policy        OverflowPolicy
+
+	aboveHighSince    time.Time
+	slowClientTimeout time.Duration
+
+	// capacityNotify is signalled (non-blockingly) whenever pop drains the
+	// queue back to its low watermark, so waitForCapacity doesn't have to
+	// busy-poll while OverflowBlockWithTimeout is waiting for room.
+	capacityNotify chan struct{}
+
+	metrics OutboundMetricsRecorder
+}
+
+func newOutboundQueue(highWatermark, lowWatermark int, policy OverflowPolicy, slowClientTimeout time.Duration, metrics OutboundMetricsRecorder) *outboundQueue {
+	return &outboundQueue{
+		keyIndex:          make(map[string]*outboundEntry),
+		highWatermark:     highWatermark,
+		lowWatermark:      lowWatermark,
+		policy:            policy,
+		slowClientTimeout: slowClientTimeout,
+		capacityNotify:    make(chan struct{}, 1),
+		metrics:           metrics,
+	}
+}
+
+// push enqueues payload, coalescing it into the already-queued entry for
+// key if key is non-empty and such an entry exists. The returned outcome
+// tells the caller what, if anything, it must do beyond what push already
+// did to the local queue (spill to Redis, or disconnect the client).
+func (q *outboundQueue) push(payload []byte, key string) outboundPushOutcome {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if key != "" {
+		if existing, ok := q.keyIndex[key]; ok {
+			existing.payload = payload
+			if q.metrics != nil {
+				q.metrics.RecordOutboundCoalesced()
+				q.metrics.ObserveOutboundQueueDepth(len(q.entries))
+			}
+			return q.watermarkOutcomeLocked()
+		}
+	}
+
+	if len(q.entries) >= q.highWatermark {
+		switch q.policy {
+		case OverflowDropNewest:
+			if q.metrics != nil {
+				q.metrics.RecordOutboundDropped()
+			}
+			return outboundDropped
+		case OverflowSpillToRedis:
+			return outboundSpill
+		case OverflowDropOldest:
+			q.dropFrontLocked()
+			if q.metrics != nil {
+				q.metrics.RecordOutboundDropped()
+			}
+		}
+		// OverflowDisconnect and OverflowBlockWithTimeout both still
+		// enqueue past the watermark: disconnect tracks how long it's
+		// stayed there, and block_with_timeout's wait already happened
+		// before push was called.
+	}
+
+	entry := &outboundEntry{key: key, payload: payload}
+	q.entries = append(q.entries, entry)
+	if key != "" {
+		q.keyIndex[key] = entry
+	}
+
+	if q.metrics != nil {
+		q.metrics.ObserveOutboundQueueDepth(len(q.entries))
+	}
+
+	return q.watermarkOutcomeLocked()
+}
+
+// pushDirect appends an already-accepted payload without re-running
+// overflow policy checks, used to drain entries previously spilled to
+// Redis back into the queue once there's room for them.
+func (q *outboundQueue) pushDirect(payload []byte, key string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if key != "" {
+		if existing, ok := q.keyIndex[key]; ok {
+			existing.payload = payload
+			return
+		}
+	}
+
+	entry := &outboundEntry{key: key, payload: payload}
+	q.entries = append(q.entries, entry)
+	if key != "" {
+		q.keyIndex[key] = entry
+	}
+
+	if q.metrics != nil {
+		q.metrics.ObserveOutboundQueueDepth(len(q.entries))
+	}
+}
+
+// pop removes and returns the oldest queued payload, if any.
+func (q *outboundQueue) pop() ([]byte, bool) {
+	q.mu.Lock()
+
+	if len(q.entries) == 0 {
+		q.mu.Unlock()
+		return nil, false
+	}
+
+	entry := q.entries[0]
+	q.dropFrontLocked()
+	q.watermarkOutcomeLocked()
+	freedCapacity := len(q.entries) <= q.lowWatermark
+	q.mu.Unlock()
+
+	if freedCapacity {
+		select {
+		case q.capacityNotify <- struct{}{}:
+		default:
+		}
+	}
+
+	return entry.payload, true
+}
+
+// isOverHighWatermark reports whether the queue is currently at or above
+// its high watermark.
+func (q *outboundQueue) isOverHighWatermark() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.entries) >= q.highWatermark
+}
+
+// waitForCapacity blocks, under OverflowBlockWithTimeout, until the queue
+// drops back under its high watermark or timeout elapses, returning false
+// in the latter case so the caller can disconnect the client instead.
+func (q *outboundQueue) waitForCapacity(timeout time.Duration) bool {
+	if !q.isOverHighWatermark() {
+		return true
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-q.capacityNotify:
+			if !q.isOverHighWatermark() {
+				return true
+			}
+		case <-timer.C:
+			return !q.isOverHighWatermark()
+		}
+	}
+}
+
+func (q *outboundQueue) recordSpilled() {
+	if q.metrics != nil {
+		q.metrics.RecordOutboundSpilled()
+	}
+}
+
+func (q *outboundQueue) recordBlockTimeout() {
+	if q.metrics != nil {
+		q.metrics.RecordOutboundBlockTimeout()
+	}
+}
+
+// dropFrontLocked discards the oldest entry; recording it as dropped, if
+// it was, is left to the caller. Must be called with mu held.
+func (q *outboundQueue) dropFrontLocked() {
+	dropped := q.entries[0]
+	q.entries = q.entries[1:]
+	if len(q.entries) == 0 {
+		q.entries = nil // release the backing array rather than let it grow forever
+	}
+	if dropped.key != "" {
+		delete(q.keyIndex, dropped.key)
+	}
+}
+
+// watermarkOutcomeLocked tracks how long the queue has continuously been
+// above its high watermark and reports outboundDisconnect once that's
+// exceeded slowClientTimeout under OverflowDisconnect. Must be called with
+// mu held.
+func (q *outboundQueue) watermarkOutcomeLocked() outboundPushOutcome {
+	if len(q.entries) > q.highWatermark {
+		if q.aboveHighSince.IsZero() {
+			q.aboveHighSince = time.Now()
+		}
+		if q.policy == OverflowDisconnect && time.Since(q.aboveHighSince) > q.slowClientTimeout {
+			return outboundDisconnect
+		}
+		return outboundPushed
+	}
+
+	if len(q.entries) <= q.lowWatermark {
+		q.aboveHighSince = time.Time{}
+	}
+	return outboundPushed
+}
@@ -109,6 +109,18 @@ func (s *Shard) GetUserClients(userID string) []*Client {
 	return clients
 }
 
+// ForEachClient invokes fn for every client currently on the shard. fn
+// must not call back into the shard (AddClient, RemoveClient, ...),
+// since it runs under the shard's read lock.
+func (s *Shard) ForEachClient(fn func(*Client)) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, client := range s.clients {
+		fn(client)
+	}
+}
+
 // RegisterAuthenticatedClient registers an authenticated client
 func (s *Shard) RegisterAuthenticatedClient(client *Client, userID, deviceID string) {
 	s.mu.Lock()
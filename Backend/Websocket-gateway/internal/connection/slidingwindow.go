@@ -0,0 +1,84 @@
+package connection
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const slidingWindowBuckets = 6
+
+// SlidingWindowCounter is a Redis-backed sliding-window rate limiter. Each
+// window is bucketed into slidingWindowBuckets sub-windows so a check only
+// ever sums a small, fixed number of INCR'd counters instead of tracking
+// every event's timestamp, while still approximating a true sliding window
+// far better than a hard reset-every-window counter would. Because the
+// counters live in Redis, the limit is coordinated across every node in
+// the cluster rather than per-process.
+type SlidingWindowCounter struct {
+	client      redis.UniversalClient
+	keyPrefix   string
+	window      time.Duration
+	bucketWidth time.Duration
+	limit       int64
+}
+
+// NewSlidingWindowCounter creates a counter that allows at most limit
+// events per window for any given key, e.g. a client IP.
+func NewSlidingWindowCounter(client redis.UniversalClient, keyPrefix string, window time.Duration, limit int) *SlidingWindowCounter {
+	return &SlidingWindowCounter{
+		client:      client,
+		keyPrefix:   keyPrefix,
+		window:      window,
+		bucketWidth: window / slidingWindowBuckets,
+		limit:       int64(limit),
+	}
+}
+
+// Allow records an event for key and reports whether the trailing window's
+// total is still within the configured limit. A Redis error fails open
+// (returns true) since a rate limiter outage shouldn't take the whole
+// gateway down with it; the error is still returned so callers can log it.
+func (c *SlidingWindowCounter) Allow(ctx context.Context, key string) (bool, error) {
+	currentBucket := time.Now().UnixNano() / c.bucketWidth.Nanoseconds()
+	currentKey := c.bucketKey(key, currentBucket)
+
+	pipe := c.client.TxPipeline()
+	pipe.Incr(ctx, currentKey)
+	pipe.PExpire(ctx, currentKey, c.window*2)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return true, fmt.Errorf("sliding window increment failed: %w", err)
+	}
+
+	bucketKeys := make([]string, slidingWindowBuckets)
+	for i := 0; i < slidingWindowBuckets; i++ {
+		bucketKeys[i] = c.bucketKey(key, currentBucket-int64(i))
+	}
+
+	values, err := c.client.MGet(ctx, bucketKeys...).Result()
+	if err != nil {
+		return true, fmt.Errorf("sliding window read failed: %w", err)
+	}
+
+	var total int64
+	for _, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			continue
+		}
+		total += n
+	}
+
+	return total <= c.limit, nil
+}
+
+func (c *SlidingWindowCounter) bucketKey(key string, bucket int64) string {
+	return fmt.Sprintf("%s:%s:%d", c.keyPrefix, key, bucket)
+}
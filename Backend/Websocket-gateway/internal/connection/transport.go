@@ -0,0 +1,82 @@
+package connection
+
+import (
+	"errors"
+	"time"
+)
+
+// Message type constants mirror gorilla/websocket's values exactly (1, 2,
+// 8, 9, 10) so WebSocketTransport can pass them straight through to the
+// underlying *websocket.Conn without translation.
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+	CloseMessage  = 8
+	PingMessage   = 9
+	PongMessage   = 10
+)
+
+// ErrTransportClosed is returned by ReadMessage/WriteMessage once a
+// transport has been closed.
+var ErrTransportClosed = errors.New("transport closed")
+
+// Transport abstracts the duplex byte-message channel between the gateway
+// and a connected client, so Client, ReadPump and WritePump don't need to
+// know whether the underlying protocol is a WebSocket upgrade, a
+// Server-Sent Events stream, or HTTP long-polling.
+type Transport interface {
+	// ReadMessage blocks until the next client->server message arrives,
+	// or returns an error once the transport is closed.
+	ReadMessage() ([]byte, error)
+
+	// WriteMessage delivers a single server->client message of the given
+	// type (TextMessage, PingMessage, ...). Transports that have no
+	// concept of a given type (e.g. SSE has no binary frames) may treat
+	// it as a no-op.
+	WriteMessage(messageType int, payload []byte) error
+
+	// Ping sends a transport-level keepalive, if the transport supports one.
+	Ping() error
+
+	// Close tears down the transport and unblocks any pending ReadMessage.
+	Close() error
+
+	// SetReadDeadline/SetWriteDeadline mirror net.Conn's deadline API so
+	// ReadPump/WritePump can reuse the same idle-timeout logic regardless
+	// of transport. Transports with no notion of a deadline are a no-op.
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+}
+
+// InboundFeeder is implemented by transports whose client->server bytes
+// arrive out of band rather than being read directly off a connection
+// (SSE's companion POST endpoint, long-poll's send endpoint). The HTTP
+// handler that receives those bytes calls Feed to deliver them to ReadPump.
+type InboundFeeder interface {
+	Feed(message []byte) error
+}
+
+// Poller is implemented by transports that buffer outbound messages for a
+// client to retrieve itself rather than pushing them over an open
+// connection (long-polling).
+type Poller interface {
+	// Poll blocks until at least one outbound message is queued or
+	// maxWait elapses, then returns and clears whatever's queued.
+	Poll(maxWait time.Duration) [][]byte
+}
+
+// PongHandlerSetter is implemented by transports with a native ping/pong
+// keepalive (WebSocket). ReadPump installs a handler via this interface
+// when the transport supports it, and is a no-op otherwise.
+type PongHandlerSetter interface {
+	SetPongHandler(handler func(appData string) error)
+}
+
+// CompressionController is implemented by transports that support
+// toggling per-message compression (WebSocket's RFC 7692 per-message
+// deflate extension, once negotiated). flushOutbound calls
+// SetWriteCompression before each write so messages below
+// Server.CompressionMinSize skip compression entirely.
+type CompressionController interface {
+	SetWriteCompression(enabled bool)
+}
@@ -0,0 +1,128 @@
+package connection
+
+import (
+	"sync"
+	"time"
+)
+
+// LongPollTransport implements Transport with no persistent connection at
+// all: client->server bytes are delivered out of band via Feed (the send
+// endpoint), and server->client bytes accumulate in an in-memory outbox
+// that Poll drains whenever the client's next GET arrives.
+type LongPollTransport struct {
+	inbound chan []byte
+
+	mu      sync.Mutex
+	outbox  [][]byte
+	notify  chan struct{}
+	closed  bool
+	closeCh chan struct{}
+	once    sync.Once
+}
+
+// NewLongPollTransport creates a transport for a single client's long-poll
+// session. The caller is responsible for keying these by ClientID so the
+// send/poll HTTP handlers can find the right one.
+func NewLongPollTransport() *LongPollTransport {
+	return &LongPollTransport{
+		inbound: make(chan []byte, 64),
+		notify:  make(chan struct{}, 1),
+		closeCh: make(chan struct{}),
+	}
+}
+
+func (t *LongPollTransport) ReadMessage() ([]byte, error) {
+	select {
+	case msg := <-t.inbound:
+		return msg, nil
+	case <-t.closeCh:
+		return nil, ErrTransportClosed
+	}
+}
+
+// WriteMessage appends payload to the outbox for the next Poll to pick up.
+// messageType is ignored: long-polling has no frame concept, every message
+// is just a blob handed back verbatim on the next GET.
+func (t *LongPollTransport) WriteMessage(messageType int, payload []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return ErrTransportClosed
+	}
+	t.outbox = append(t.outbox, payload)
+	select {
+	case t.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Ping is a no-op: there's no standing connection to keep alive between polls.
+func (t *LongPollTransport) Ping() error {
+	return nil
+}
+
+func (t *LongPollTransport) Close() error {
+	t.mu.Lock()
+	t.closed = true
+	t.mu.Unlock()
+	t.once.Do(func() { close(t.closeCh) })
+	return nil
+}
+
+// Poll blocks until the outbox is non-empty or maxWait elapses, then
+// returns and clears whatever's queued. Once the transport is closed it
+// returns immediately with whatever was left in the outbox; it does not
+// report whether the transport is still open.
+func (t *LongPollTransport) Poll(maxWait time.Duration) [][]byte {
+	t.mu.Lock()
+	if len(t.outbox) > 0 {
+		msgs := t.outbox
+		t.outbox = nil
+		t.mu.Unlock()
+		return msgs
+	}
+	t.mu.Unlock()
+
+	timer := time.NewTimer(maxWait)
+	defer timer.Stop()
+
+	select {
+	case <-t.notify:
+	case <-t.closeCh:
+	case <-timer.C:
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	msgs := t.outbox
+	t.outbox = nil
+	return msgs
+}
+
+// Feed delivers a client->server message received on the companion POST
+// endpoint to ReadMessage.
+func (t *LongPollTransport) Feed(message []byte) error {
+	select {
+	case <-t.closeCh:
+		return ErrTransportClosed
+	default:
+	}
+	select {
+	case t.inbound <- message:
+		return nil
+	case <-t.closeCh:
+		return ErrTransportClosed
+	}
+}
+
+// SetReadDeadline/SetWriteDeadline are no-ops: long-polling has no
+// underlying socket to apply a deadline to.
+func (t *LongPollTransport) SetReadDeadline(deadline time.Time) error  { return nil }
+func (t *LongPollTransport) SetWriteDeadline(deadline time.Time) error { return nil }
+
+var (
+	_ Transport     = (*LongPollTransport)(nil)
+	_ InboundFeeder = (*LongPollTransport)(nil)
+	_ Poller        = (*LongPollTransport)(nil)
+)
@@ -0,0 +1,111 @@
+package connection
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// SSETransport implements Transport over a Server-Sent Events stream for the
+// server->client direction. There is no way for an SSE client to send bytes
+// back over the same HTTP response, so client->server messages instead
+// arrive out of band through the companion POST endpoint, which delivers
+// them to ReadMessage via Feed.
+type SSETransport struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+
+	inbound chan []byte
+
+	mu        sync.Mutex
+	closed    bool
+	closeCh   chan struct{}
+	closeOnce sync.Once
+}
+
+// NewSSETransport wraps the ResponseWriter of an already-established SSE
+// stream (headers and 200 status already written by the caller).
+func NewSSETransport(w http.ResponseWriter, flusher http.Flusher) *SSETransport {
+	return &SSETransport{
+		w:       w,
+		flusher: flusher,
+		inbound: make(chan []byte, 64),
+		closeCh: make(chan struct{}),
+	}
+}
+
+func (t *SSETransport) ReadMessage() ([]byte, error) {
+	select {
+	case msg := <-t.inbound:
+		return msg, nil
+	case <-t.closeCh:
+		return nil, ErrTransportClosed
+	}
+}
+
+// WriteMessage writes payload as a single SSE "data:" event and flushes it
+// immediately. messageType is ignored: SSE has no binary/close/ping frame
+// concept, those are handled by Ping and Close instead.
+func (t *SSETransport) WriteMessage(messageType int, payload []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return ErrTransportClosed
+	}
+	if _, err := fmt.Fprintf(t.w, "data: %s\n\n", payload); err != nil {
+		return err
+	}
+	t.flusher.Flush()
+	return nil
+}
+
+// Ping writes an SSE comment line, which clients and intermediate proxies
+// ignore as data but which keeps the underlying TCP connection from being
+// reaped as idle.
+func (t *SSETransport) Ping() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return ErrTransportClosed
+	}
+	if _, err := fmt.Fprint(t.w, ": keepalive\n\n"); err != nil {
+		return err
+	}
+	t.flusher.Flush()
+	return nil
+}
+
+func (t *SSETransport) Close() error {
+	t.mu.Lock()
+	t.closed = true
+	t.mu.Unlock()
+	t.closeOnce.Do(func() { close(t.closeCh) })
+	return nil
+}
+
+// Feed delivers a client->server message received on the companion POST
+// endpoint to ReadMessage.
+func (t *SSETransport) Feed(message []byte) error {
+	select {
+	case <-t.closeCh:
+		return ErrTransportClosed
+	default:
+	}
+	select {
+	case t.inbound <- message:
+		return nil
+	case <-t.closeCh:
+		return ErrTransportClosed
+	}
+}
+
+// SetReadDeadline/SetWriteDeadline are no-ops: an SSE stream's lifetime is
+// governed by the HTTP response, not a socket deadline.
+func (t *SSETransport) SetReadDeadline(deadline time.Time) error  { return nil }
+func (t *SSETransport) SetWriteDeadline(deadline time.Time) error { return nil }
+
+var (
+	_ Transport     = (*SSETransport)(nil)
+	_ InboundFeeder = (*SSETransport)(nil)
+)
@@ -0,0 +1,57 @@
+package connection
+
+import (
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebSocketTransport adapts a *websocket.Conn to the Transport interface.
+// Its message type constants are numerically identical to gorilla/websocket's
+// own, so they pass straight through to conn.WriteMessage untranslated.
+type WebSocketTransport struct {
+	conn *websocket.Conn
+}
+
+// NewWebSocketTransport wraps an upgraded WebSocket connection as a Transport.
+func NewWebSocketTransport(conn *websocket.Conn) *WebSocketTransport {
+	return &WebSocketTransport{conn: conn}
+}
+
+func (t *WebSocketTransport) ReadMessage() ([]byte, error) {
+	_, payload, err := t.conn.ReadMessage()
+	return payload, err
+}
+
+func (t *WebSocketTransport) WriteMessage(messageType int, payload []byte) error {
+	return t.conn.WriteMessage(messageType, payload)
+}
+
+func (t *WebSocketTransport) Ping() error {
+	return t.conn.WriteMessage(websocket.PingMessage, nil)
+}
+
+func (t *WebSocketTransport) Close() error {
+	return t.conn.Close()
+}
+
+func (t *WebSocketTransport) SetReadDeadline(deadline time.Time) error {
+	return t.conn.SetReadDeadline(deadline)
+}
+
+func (t *WebSocketTransport) SetWriteDeadline(deadline time.Time) error {
+	return t.conn.SetWriteDeadline(deadline)
+}
+
+// SetPongHandler implements PongHandlerSetter so ReadPump can reset the read
+// deadline whenever a pong arrives, same as before the Transport refactor.
+func (t *WebSocketTransport) SetPongHandler(handler func(appData string) error) {
+	t.conn.SetPongHandler(handler)
+}
+
+// SetWriteCompression implements CompressionController, toggling
+// per-message deflate for the next WriteMessage call. A no-op if the
+// client didn't negotiate the extension during the upgrade.
+func (t *WebSocketTransport) SetWriteCompression(enabled bool) {
+	t.conn.EnableWriteCompression(enabled)
+}
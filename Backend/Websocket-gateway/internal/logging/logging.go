@@ -0,0 +1,56 @@
+// Package logging builds the gateway's root zap logger around a
+// zap.AtomicLevel so the operator can raise or lower verbosity at
+// runtime via HTTP, and provides context helpers so a connection's
+// request-scoped fields (client_id, user_id, ...) travel with ctx into
+// code that doesn't hold a direct reference to the originating Client.
+package logging
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/yourcompany/websocket-gateway/internal/config"
+)
+
+type ctxKey struct{}
+
+// NewLogger builds the gateway's root logger from cfg.Observability.LogLevel
+// and returns its zap.AtomicLevel so the caller can expose it over HTTP
+// (zap.AtomicLevel implements http.Handler: GET returns the current
+// level, PUT with a JSON body changes it, no restart required).
+func NewLogger(cfg *config.Config) (*zap.Logger, zap.AtomicLevel, error) {
+	level, err := zapcore.ParseLevel(cfg.Observability.LogLevel)
+	if err != nil {
+		return nil, zap.AtomicLevel{}, fmt.Errorf("logging: invalid log level %q: %w", cfg.Observability.LogLevel, err)
+	}
+
+	atomicLevel := zap.NewAtomicLevelAt(level)
+
+	zapCfg := zap.NewProductionConfig()
+	zapCfg.Level = atomicLevel
+
+	logger, err := zapCfg.Build()
+	if err != nil {
+		return nil, zap.AtomicLevel{}, fmt.Errorf("logging: build logger: %w", err)
+	}
+
+	return logger, atomicLevel, nil
+}
+
+// WithContext returns a copy of ctx carrying logger, retrievable via
+// FromContext.
+func WithContext(ctx context.Context, logger *zap.Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, logger)
+}
+
+// FromContext returns the logger embedded in ctx by WithContext, or
+// zap.L() (the global logger) if none was embedded.
+func FromContext(ctx context.Context) *zap.Logger {
+	if logger, ok := ctx.Value(ctxKey{}).(*zap.Logger); ok {
+		return logger
+	}
+	return zap.L()
+}
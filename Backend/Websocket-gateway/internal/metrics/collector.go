@@ -10,42 +10,102 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 
+	"github.com/yourcompany/websocket-gateway/internal/cluster"
 	"github.com/yourcompany/websocket-gateway/internal/connection"
+	"github.com/yourcompany/websocket-gateway/internal/connection/faultinject"
 )
 
+var _ connection.OutboundMetricsRecorder = (*MetricsCollector)(nil)
+
 // MetricsCollector collects and exposes metrics
 type MetricsCollector struct {
 	// Prometheus metrics
 	activeConnections     prometheus.Gauge
 	totalConnections      prometheus.Counter
-	messagesReceived      prometheus.Counter
-	messagesSent          prometheus.Counter
 	messageLatency        prometheus.Histogram
 	authAttempts          prometheus.Counter
 	authFailures          prometheus.Counter
 	rateLimitHits         prometheus.Counter
 	shardConnections      *prometheus.GaugeVec
 	errorCount            *prometheus.CounterVec
-	
+
+	// Distinct-active-user gauges, snapshotted from connMgr's HLL
+	// sketches on a timer since recomputing them is O(registers), not
+	// O(users), but still isn't free enough to do per-scrape.
+	activeUsers1h         prometheus.Gauge
+	activeUsers24h        prometheus.Gauge
+
+	// Per-message-type counters/histogram, replacing the old
+	// undifferentiated messagesReceived/messagesSent counters which
+	// weren't granular enough for capacity planning.
+	messagesReceivedByType *prometheus.CounterVec
+	messagesSentByType     *prometheus.CounterVec
+	messagesPerUserPerSec  *prometheus.HistogramVec
+
+	// Per-connection outbound queue telemetry (internal/connection's
+	// OutboundMetricsRecorder). outboundQueueDepth is a histogram rather
+	// than a per-client gauge to avoid a client_id label's cardinality.
+	outboundQueueDepth    prometheus.Histogram
+	outboundDropped       prometheus.Counter
+	outboundCoalesced     prometheus.Counter
+	outboundSpilled       prometheus.Counter
+	outboundBlockTimeouts prometheus.Counter
+
 	// Internal state
-	logger     *zap.Logger
-	connMgr    *connection.Manager
-	server     *http.Server
+	logger       *zap.Logger
+	connMgr      *connection.Manager
+	server       *http.Server
+	logLevel     zap.AtomicLevel
+	faultInjector *faultinject.Injector
+	clusterRegistry *cluster.Registry
+
+	rateMu       sync.Mutex
+	lastSeenByUser map[string]time.Time
+
+	shutdownChan chan struct{}
 }
 
-// NewMetricsCollector creates a new metrics collector
-func NewMetricsCollector(port int, connMgr *connection.Manager, logger *zap.Logger) *MetricsCollector {
+const activeUsersSnapshotInterval = 30 * time.Second
+
+// userRateStaleAfter bounds how long a userID lingers in lastSeenByUser
+// with no new message: the per-user rate gap it tracks is meaningless
+// across a gap this long anyway, so there's no reason to hold the entry.
+// Without this, lastSeenByUser grows by one entry per distinct userID
+// ever seen and is never evicted -- the same unbounded-memory problem
+// the HLL sketches (activeUsers1h/24h) exist to avoid.
+const userRateStaleAfter = 10 * time.Minute
+
+// NewMetricsCollector creates a new metrics collector. logLevel is
+// exposed on the /loglevel endpoint so an operator can raise or lower
+// verbosity at runtime without restarting the gateway. faultInjector may
+// be nil (fault injection disabled), in which case /debug/faults isn't
+// mounted at all. clusterRegistry may be nil (no cluster registry
+// configured), in which case /cluster/propose and /cluster/status
+// aren't mounted.
+func NewMetricsCollector(port int, connMgr *connection.Manager, logLevel zap.AtomicLevel, faultInjector *faultinject.Injector, clusterRegistry *cluster.Registry, logger *zap.Logger) *MetricsCollector {
 	collector := &MetricsCollector{
-		logger:  logger,
-		connMgr: connMgr,
+		logger:          logger,
+		connMgr:         connMgr,
+		logLevel:        logLevel,
+		faultInjector:   faultInjector,
+		clusterRegistry: clusterRegistry,
+		lastSeenByUser:  make(map[string]time.Time),
+		shutdownChan:    make(chan struct{}),
 	}
-	
+
 	// Register metrics
 	collector.registerMetrics()
-	
+
+	// Report outbound-queue telemetry from every client's coalescing ring
+	// buffer through this collector.
+	connMgr.SetOutboundMetricsRecorder(collector)
+
 	// Start HTTP server for metrics
 	collector.startMetricsServer(port)
-	
+
+	// Start active-user gauge snapshotting
+	go collector.runActiveUsersSnapshot()
+
 	return collector
 }
 
@@ -60,16 +120,58 @@ func (m *MetricsCollector) registerMetrics() {
 		Help: "Total number of WebSocket connections since startup",
 	})
 	
-	m.messagesReceived = promauto.NewCounter(prometheus.CounterOpts{
-		Name: "websocket_gateway_messages_received_total",
-		Help: "Total number of messages received",
+	m.messagesReceivedByType = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "messages_received_total",
+		Help: "Total number of messages received, labeled by message type",
+	}, []string{"type"})
+
+	m.messagesSentByType = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "messages_sent_total",
+		Help: "Total number of messages sent, labeled by message type",
+	}, []string{"type"})
+
+	m.messagesPerUserPerSec = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "messages_per_user_per_second",
+		Help:    "Observed per-user message rate, labeled by message type, for abuse detection",
+		Buckets: []float64{.1, .5, 1, 2, 5, 10, 25, 50, 100},
+	}, []string{"type"})
+
+	m.activeUsers1h = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "websocket_gateway_active_users_1h",
+		Help: "Estimated distinct active users over the trailing hour",
 	})
-	
-	m.messagesSent = promauto.NewCounter(prometheus.CounterOpts{
-		Name: "websocket_gateway_messages_sent_total",
-		Help: "Total number of messages sent",
+
+	m.activeUsers24h = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "websocket_gateway_active_users_24h",
+		Help: "Estimated distinct active users over the trailing day",
 	})
-	
+
+	m.outboundQueueDepth = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "outbound_queue_depth",
+		Help:    "Depth of a client's outbound queue observed on each enqueue",
+		Buckets: []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000},
+	})
+
+	m.outboundDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "outbound_dropped_total",
+		Help: "Total number of outbound messages dropped for exceeding the high watermark under the drop_oldest or drop_newest policy",
+	})
+
+	m.outboundCoalesced = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "outbound_coalesced_total",
+		Help: "Total number of outbound presence/typing updates coalesced into an already-queued update",
+	})
+
+	m.outboundSpilled = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "outbound_spilled_total",
+		Help: "Total number of outbound messages spilled to Redis overflow lists under the spill_to_redis backpressure policy",
+	})
+
+	m.outboundBlockTimeouts = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "outbound_block_timeouts_total",
+		Help: "Total number of clients disconnected after their outbound queue stayed full past the block_with_timeout deadline",
+	})
+
 	m.messageLatency = promauto.NewHistogram(prometheus.HistogramOpts{
 		Name:    "websocket_gateway_message_latency_seconds",
 		Help:    "Message processing latency in seconds",
@@ -108,7 +210,14 @@ func (m *MetricsCollector) startMetricsServer(port int) {
 	mux.Handle("/metrics", promhttp.Handler())
 	mux.Handle("/health", http.HandlerFunc(m.healthHandler))
 	mux.Handle("/stats", http.HandlerFunc(m.statsHandler))
-	
+	mux.Handle("/loglevel", m.logLevel)
+	if m.faultInjector != nil {
+		mux.Handle("/debug/faults", http.HandlerFunc(m.faultInjector.HandleDebugFaults))
+	}
+	if m.clusterRegistry != nil {
+		m.clusterRegistry.RegisterAdminRoutes(mux)
+	}
+
 	m.server = &http.Server{
 		Addr:         fmt.Sprintf(":%d", port),
 		Handler:      mux,
@@ -137,14 +246,102 @@ func (m *MetricsCollector) UpdateConnectionMetrics(stats map[uint32]connection.S
 	m.activeConnections.Set(float64(totalActive))
 }
 
-// RecordMessageReceived records a received message
-func (m *MetricsCollector) RecordMessageReceived() {
-	m.messagesReceived.Inc()
+// RecordMessageReceived records a received message of the given
+// protocol.Type* value and observes its contribution to the sending
+// user's per-second message rate.
+func (m *MetricsCollector) RecordMessageReceived(msgType, userID string) {
+	m.messagesReceivedByType.WithLabelValues(msgType).Inc()
+	m.observeUserRate(msgType, userID)
+}
+
+// RecordMessageSent records a message delivered to a client.
+func (m *MetricsCollector) RecordMessageSent(msgType string) {
+	m.messagesSentByType.WithLabelValues(msgType).Inc()
+}
+
+// observeUserRate tracks the wall-clock gap between consecutive messages
+// from the same user and feeds its inverse (messages/sec) into the
+// per-type histogram, so operators can alert on per-user abuse patterns
+// instead of only the aggregate rate.
+func (m *MetricsCollector) observeUserRate(msgType, userID string) {
+	now := time.Now()
+
+	m.rateMu.Lock()
+	last, seen := m.lastSeenByUser[userID]
+	m.lastSeenByUser[userID] = now
+	m.rateMu.Unlock()
+
+	if !seen {
+		return
+	}
+
+	delta := now.Sub(last).Seconds()
+	if delta <= 0 {
+		return
+	}
+	m.messagesPerUserPerSec.WithLabelValues(msgType).Observe(1 / delta)
+}
+
+// evictStaleUserRates drops lastSeenByUser entries that haven't been
+// touched in userRateStaleAfter, so a user who stops sending messages
+// (disconnects, goes idle) doesn't linger in memory forever.
+func (m *MetricsCollector) evictStaleUserRates() {
+	cutoff := time.Now().Add(-userRateStaleAfter)
+
+	m.rateMu.Lock()
+	defer m.rateMu.Unlock()
+
+	for userID, lastSeen := range m.lastSeenByUser {
+		if lastSeen.Before(cutoff) {
+			delete(m.lastSeenByUser, userID)
+		}
+	}
+}
+
+// ObserveOutboundQueueDepth implements connection.OutboundMetricsRecorder.
+func (m *MetricsCollector) ObserveOutboundQueueDepth(depth int) {
+	m.outboundQueueDepth.Observe(float64(depth))
+}
+
+// RecordOutboundDropped implements connection.OutboundMetricsRecorder.
+func (m *MetricsCollector) RecordOutboundDropped() {
+	m.outboundDropped.Inc()
+}
+
+// RecordOutboundCoalesced implements connection.OutboundMetricsRecorder.
+func (m *MetricsCollector) RecordOutboundCoalesced() {
+	m.outboundCoalesced.Inc()
 }
 
-// RecordMessageSent records a sent message
-func (m *MetricsCollector) RecordMessageSent() {
-	m.messagesSent.Inc()
+// RecordOutboundSpilled implements connection.OutboundMetricsRecorder.
+func (m *MetricsCollector) RecordOutboundSpilled() {
+	m.outboundSpilled.Inc()
+}
+
+// RecordOutboundBlockTimeout implements connection.OutboundMetricsRecorder.
+func (m *MetricsCollector) RecordOutboundBlockTimeout() {
+	m.outboundBlockTimeouts.Inc()
+}
+
+// runActiveUsersSnapshot periodically copies the connection manager's HLL
+// estimates into the active-user gauges. Recomputing an HLL estimate
+// merges every register, so it's cheap but not free enough to redo on
+// every Prometheus scrape.
+func (m *MetricsCollector) runActiveUsersSnapshot() {
+	ticker := time.NewTicker(activeUsersSnapshotInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.shutdownChan:
+			return
+		case <-ticker.C:
+			last1h, last24h := m.connMgr.ActiveUserCounts()
+			m.activeUsers1h.Set(float64(last1h))
+			m.activeUsers24h.Set(float64(last24h))
+			m.evictStaleUserRates()
+		}
+	}
 }
 
 // RecordAuthAttempt records an authentication attempt
@@ -182,8 +379,6 @@ func (m *MetricsCollector) statsHandler(w http.ResponseWriter, r *http.Request)
 	stats := map[string]interface{}{
 		"active_connections":   m.activeConnections,
 		"total_connections":    m.totalConnections,
-		"messages_received":    m.messagesReceived,
-		"messages_sent":        m.messagesSent,
 		"uptime":               time.Since(startTime).String(),
 		"timestamp":            time.Now().Unix(),
 	}
@@ -193,6 +388,8 @@ func (m *MetricsCollector) statsHandler(w http.ResponseWriter, r *http.Request)
 
 // Shutdown gracefully shuts down the metrics server
 func (m *MetricsCollector) Shutdown() {
+	close(m.shutdownChan)
+
 	if m.server != nil {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
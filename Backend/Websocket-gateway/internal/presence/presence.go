@@ -0,0 +1,499 @@
+// Package presence maintains authoritative online/away/offline state per
+// user, with per-device aggregation, and fans out presence and typing
+// updates across nodes over Redis pub/sub so that a change observed by
+// the node holding a user's connection reaches subscribers connected to
+// any other node.
+package presence
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/yourcompany/websocket-gateway/internal/config"
+	"github.com/yourcompany/websocket-gateway/internal/connection"
+	"github.com/yourcompany/websocket-gateway/pkg/protocol"
+)
+
+// Manager satisfies connection.PresenceNotifier, so connection.Manager can
+// drive device connect/disconnect tracking without importing this package
+// directly.
+var _ connection.PresenceNotifier = (*Manager)(nil)
+
+const (
+	// typingCoalesceWindow suppresses repeat is_typing=true events from
+	// the same (user, chat) pair so a client doesn't re-announce on
+	// every keystroke.
+	typingCoalesceWindow = 3 * time.Second
+
+	// typingAutoStopTimeout auto-emits is_typing=false if no renewal
+	// arrives, so a client that disconnects mid-type doesn't leave
+	// watchers stuck showing "typing...".
+	typingAutoStopTimeout = 5 * time.Second
+)
+
+const (
+	StatusOnline  = "online"
+	StatusAway    = "away"
+	StatusOffline = "offline"
+)
+
+// Manager is the primary API surface for presence and typing: Publish
+// fans a message out locally and across nodes, and SubscribeToUser
+// delivers presence changes for a given user to a local callback
+// regardless of which node observed the change.
+type Manager struct {
+	redis         redis.UniversalClient
+	channelPrefix string
+	nodeID        string
+	idleThreshold time.Duration
+	logger        *zap.Logger
+
+	mu               sync.Mutex
+	devices          map[string]map[string]time.Time  // userID -> deviceID -> lastActivity
+	status           map[string]string                // userID -> current aggregate status
+	subscribers      map[string][]presenceSubscriber  // userID -> watchers
+	typingSubscribers map[string][]typingSubscriber   // chatID -> watchers
+	typingState      map[string]*typingEntry          // "userID:chatID" -> coalescing state
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+type presenceSubscriber struct {
+	id      string
+	handler func(protocol.PresenceUpdate)
+}
+
+type typingSubscriber struct {
+	id      string
+	handler func(protocol.TypingIndicator)
+}
+
+type typingEntry struct {
+	lastSentTrue time.Time
+	stopTimer    *time.Timer
+}
+
+// NewManager creates a presence manager and starts its idle-sweep and
+// cross-node subscription goroutines.
+func NewManager(cfg *config.Config, redisClient redis.UniversalClient, logger *zap.Logger) *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	m := &Manager{
+		redis:         redisClient,
+		channelPrefix: cfg.Redis.PubSubChannelPrefix,
+		nodeID:        cfg.Cluster.NodeID,
+		idleThreshold: cfg.Presence.IdleThreshold,
+		logger:        logger,
+		devices:           make(map[string]map[string]time.Time),
+		status:            make(map[string]string),
+		subscribers:       make(map[string][]presenceSubscriber),
+		typingSubscribers: make(map[string][]typingSubscriber),
+		typingState:       make(map[string]*typingEntry),
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+
+	m.wg.Add(3)
+	go m.runIdleSweep()
+	go m.runRedisSubscriber(fmt.Sprintf("%s:presence:*", m.channelPrefix), m.handleRemotePresence)
+	go m.runRedisSubscriber(fmt.Sprintf("%s:typing:*", m.channelPrefix), m.handleRemoteTyping)
+
+	return m
+}
+
+func (m *Manager) presenceChannel(userID string) string {
+	return fmt.Sprintf("%s:presence:%s", m.channelPrefix, userID)
+}
+
+func (m *Manager) typingChannel(chatID string) string {
+	return fmt.Sprintf("%s:typing:%s", m.channelPrefix, chatID)
+}
+
+// DeviceConnected marks a device online for userID. If this is the
+// user's first active device, the aggregate status becomes "online" and
+// is published to subscribers.
+func (m *Manager) DeviceConnected(userID, deviceID string) {
+	m.mu.Lock()
+	if m.devices[userID] == nil {
+		m.devices[userID] = make(map[string]time.Time)
+	}
+	m.devices[userID][deviceID] = time.Now()
+	m.mu.Unlock()
+
+	m.recomputeAndPublish(userID)
+}
+
+// DeviceDisconnected marks a device offline. If it was the user's last
+// device, the aggregate status becomes "offline".
+func (m *Manager) DeviceDisconnected(userID, deviceID string) {
+	m.mu.Lock()
+	if devices, ok := m.devices[userID]; ok {
+		delete(devices, deviceID)
+		if len(devices) == 0 {
+			delete(m.devices, userID)
+		}
+	}
+	m.mu.Unlock()
+
+	m.recomputeAndPublish(userID)
+}
+
+// Touch records activity for a device (e.g. on each inbound message or
+// heartbeat) so idle detection doesn't demote an active user to "away".
+func (m *Manager) Touch(userID, deviceID string) {
+	m.mu.Lock()
+	if m.devices[userID] == nil {
+		m.devices[userID] = make(map[string]time.Time)
+	}
+	m.devices[userID][deviceID] = time.Now()
+	wasAway := m.status[userID] == StatusAway
+	m.mu.Unlock()
+
+	if wasAway {
+		m.recomputeAndPublish(userID)
+	}
+}
+
+// recomputeAndPublish derives the aggregate status for userID from its
+// device set and publishes a change, skipping the publish if the status
+// didn't actually move.
+func (m *Manager) recomputeAndPublish(userID string) {
+	status, changed := m.computeStatus(userID)
+	if !changed {
+		return
+	}
+
+	update := protocol.PresenceUpdate{
+		BaseMessage: protocol.NewBaseMessage(protocol.TypePresence),
+		UserID:      userID,
+		Status:      status,
+		LastSeen:    time.Now().UnixMilli(),
+	}
+
+	if err := m.publishPresence(context.Background(), update); err != nil {
+		m.logger.Warn("failed to publish presence update",
+			zap.String("user_id", userID), zap.Error(err))
+	}
+}
+
+func (m *Manager) computeStatus(userID string) (status string, changed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	devices := m.devices[userID]
+	newStatus := StatusOffline
+	if len(devices) > 0 {
+		newStatus = StatusOnline
+		for _, lastActivity := range devices {
+			if time.Since(lastActivity) > m.idleThreshold {
+				// Only demote to away if every device is idle.
+				continue
+			}
+			newStatus = StatusOnline
+			break
+		}
+		if allIdle(devices, m.idleThreshold) {
+			newStatus = StatusAway
+		}
+	}
+
+	old := m.status[userID]
+	if old == newStatus {
+		return newStatus, false
+	}
+
+	if newStatus == StatusOffline {
+		delete(m.status, userID)
+	} else {
+		m.status[userID] = newStatus
+	}
+	return newStatus, true
+}
+
+func allIdle(devices map[string]time.Time, threshold time.Duration) bool {
+	for _, lastActivity := range devices {
+		if time.Since(lastActivity) <= threshold {
+			return false
+		}
+	}
+	return true
+}
+
+// runIdleSweep periodically recomputes status for every tracked user so
+// an idle-but-still-connected user transitions to "away" without
+// needing a new event to trigger the check.
+func (m *Manager) runIdleSweep() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(m.idleThreshold / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+			m.mu.Lock()
+			userIDs := make([]string, 0, len(m.devices))
+			for userID := range m.devices {
+				userIDs = append(userIDs, userID)
+			}
+			m.mu.Unlock()
+
+			for _, userID := range userIDs {
+				m.recomputeAndPublish(userID)
+			}
+		}
+	}
+}
+
+// SetTyping coalesces repeated is_typing=true events within
+// typingCoalesceWindow and auto-emits is_typing=false after
+// typingAutoStopTimeout if no renewal arrives, so callers can report
+// typing state on every keystroke without worrying about spamming
+// subscribers or leaking a stuck "typing..." indicator.
+func (m *Manager) SetTyping(userID, chatID string, isTyping bool) {
+	key := userID + ":" + chatID
+
+	m.mu.Lock()
+	entry, exists := m.typingState[key]
+	if !exists {
+		entry = &typingEntry{}
+		m.typingState[key] = entry
+	}
+
+	if isTyping {
+		suppressed := exists && time.Since(entry.lastSentTrue) < typingCoalesceWindow
+		entry.lastSentTrue = time.Now()
+		if entry.stopTimer != nil {
+			entry.stopTimer.Stop()
+		}
+		entry.stopTimer = time.AfterFunc(typingAutoStopTimeout, func() {
+			m.SetTyping(userID, chatID, false)
+		})
+		m.mu.Unlock()
+
+		if suppressed {
+			return
+		}
+	} else {
+		if entry.stopTimer != nil {
+			entry.stopTimer.Stop()
+		}
+		delete(m.typingState, key)
+		m.mu.Unlock()
+	}
+
+	indicator := protocol.TypingIndicator{
+		BaseMessage: protocol.NewBaseMessage(protocol.TypeTyping),
+		UserID:      userID,
+		ChatID:      chatID,
+		IsTyping:    isTyping,
+	}
+
+	if err := m.publishTyping(context.Background(), chatID, indicator); err != nil {
+		m.logger.Warn("failed to publish typing indicator",
+			zap.String("user_id", userID), zap.String("chat_id", chatID), zap.Error(err))
+	}
+}
+
+// SubscribeToUser registers handler to be invoked with every presence
+// update for userID, whether observed locally or relayed from another
+// node over Redis. The returned func removes the subscription.
+func (m *Manager) SubscribeToUser(userID string, handler func(protocol.PresenceUpdate)) func() {
+	id := uuid.New().String()
+
+	m.mu.Lock()
+	m.subscribers[userID] = append(m.subscribers[userID], presenceSubscriber{id: id, handler: handler})
+	m.mu.Unlock()
+
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		subs := m.subscribers[userID]
+		for i, sub := range subs {
+			if sub.id == id {
+				m.subscribers[userID] = append(subs[:i], subs[i+1:]...)
+				break
+			}
+		}
+		if len(m.subscribers[userID]) == 0 {
+			delete(m.subscribers, userID)
+		}
+	}
+}
+
+// SubscribeToChat registers handler to be invoked with every typing
+// indicator for chatID, local or relayed from another node. The
+// returned func removes the subscription.
+func (m *Manager) SubscribeToChat(chatID string, handler func(protocol.TypingIndicator)) func() {
+	id := uuid.New().String()
+
+	m.mu.Lock()
+	m.typingSubscribers[chatID] = append(m.typingSubscribers[chatID], typingSubscriber{id: id, handler: handler})
+	m.mu.Unlock()
+
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		subs := m.typingSubscribers[chatID]
+		for i, sub := range subs {
+			if sub.id == id {
+				m.typingSubscribers[chatID] = append(subs[:i], subs[i+1:]...)
+				break
+			}
+		}
+		if len(m.typingSubscribers[chatID]) == 0 {
+			delete(m.typingSubscribers, chatID)
+		}
+	}
+}
+
+// Publish fans msg out to local subscribers and, for cross-node
+// delivery, to Redis. PresenceUpdate and TypingIndicator are the only
+// message types this layer understands.
+func (m *Manager) Publish(ctx context.Context, msg interface{}) error {
+	switch v := msg.(type) {
+	case protocol.PresenceUpdate:
+		return m.publishPresence(ctx, v)
+	case protocol.TypingIndicator:
+		return m.publishTyping(ctx, v.ChatID, v)
+	default:
+		return fmt.Errorf("presence: unsupported message type %T", msg)
+	}
+}
+
+func (m *Manager) publishPresence(ctx context.Context, update protocol.PresenceUpdate) error {
+	m.notifyLocalSubscribers(update)
+	return m.publishRemote(ctx, m.presenceChannel(update.UserID), update)
+}
+
+func (m *Manager) notifyLocalSubscribers(update protocol.PresenceUpdate) {
+	m.mu.Lock()
+	subs := append([]presenceSubscriber(nil), m.subscribers[update.UserID]...)
+	m.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.handler(update)
+	}
+}
+
+func (m *Manager) publishTyping(ctx context.Context, chatID string, indicator protocol.TypingIndicator) error {
+	m.notifyLocalTypingSubscribers(chatID, indicator)
+	return m.publishRemote(ctx, m.typingChannel(chatID), indicator)
+}
+
+func (m *Manager) notifyLocalTypingSubscribers(chatID string, indicator protocol.TypingIndicator) {
+	m.mu.Lock()
+	subs := append([]typingSubscriber(nil), m.typingSubscribers[chatID]...)
+	m.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.handler(indicator)
+	}
+}
+
+// publishRemote wraps msg in a node-tagged envelope (mirroring
+// internal/pubsub's loop-prevention scheme) and publishes it to channel.
+func (m *Manager) publishRemote(ctx context.Context, channel string, msg interface{}) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("presence: marshal message: %w", err)
+	}
+
+	envelope := struct {
+		NodeID  string          `json:"node_id"`
+		Message json.RawMessage `json:"message"`
+	}{NodeID: m.nodeID, Message: payload}
+
+	raw, err := json.Marshal(envelope)
+	if err != nil {
+		return fmt.Errorf("presence: marshal envelope: %w", err)
+	}
+
+	return m.redis.Publish(ctx, channel, raw).Err()
+}
+
+// runRedisSubscriber listens on pattern and re-dispatches remote updates
+// to local subscribers via handle, so a change observed on node A
+// reaches a client connected to node B.
+func (m *Manager) runRedisSubscriber(pattern string, handle func(*redis.Message)) {
+	defer m.wg.Done()
+
+	sub := m.redis.PSubscribe(m.ctx, pattern)
+	defer sub.Close()
+
+	ch := sub.Channel()
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case redisMsg, ok := <-ch:
+			if !ok {
+				return
+			}
+			handle(redisMsg)
+		}
+	}
+}
+
+func (m *Manager) handleRemotePresence(redisMsg *redis.Message) {
+	var envelope struct {
+		NodeID  string          `json:"node_id"`
+		Message json.RawMessage `json:"message"`
+	}
+	if err := json.Unmarshal([]byte(redisMsg.Payload), &envelope); err != nil {
+		m.logger.Error("presence: failed to decode envelope", zap.Error(err))
+		return
+	}
+	if envelope.NodeID == m.nodeID {
+		return // published by this node; already delivered locally
+	}
+
+	var update protocol.PresenceUpdate
+	if err := json.Unmarshal(envelope.Message, &update); err != nil {
+		m.logger.Error("presence: failed to decode presence update", zap.Error(err))
+		return
+	}
+
+	m.notifyLocalSubscribers(update)
+}
+
+func (m *Manager) handleRemoteTyping(redisMsg *redis.Message) {
+	var envelope struct {
+		NodeID  string          `json:"node_id"`
+		Message json.RawMessage `json:"message"`
+	}
+	if err := json.Unmarshal([]byte(redisMsg.Payload), &envelope); err != nil {
+		m.logger.Error("presence: failed to decode envelope", zap.Error(err))
+		return
+	}
+	if envelope.NodeID == m.nodeID {
+		return
+	}
+
+	var indicator protocol.TypingIndicator
+	if err := json.Unmarshal(envelope.Message, &indicator); err != nil {
+		m.logger.Error("presence: failed to decode typing indicator", zap.Error(err))
+		return
+	}
+
+	m.notifyLocalTypingSubscribers(indicator.ChatID, indicator)
+}
+
+// Shutdown stops the idle sweep and Redis subscription goroutines.
+func (m *Manager) Shutdown() {
+	m.cancel()
+	m.wg.Wait()
+}
@@ -0,0 +1,396 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+
+	"github.com/yourcompany/websocket-gateway/internal/config"
+	"github.com/yourcompany/websocket-gateway/pkg/protocol"
+)
+
+// NATSPubSub implements PubSub on top of NATS JetStream, trading the
+// simplicity of Redis pub/sub for durable, at-least-once delivery: a
+// message published while a subscriber's node is briefly disconnected
+// is replayed once that node's durable consumer reconnects, instead of
+// being silently dropped.
+type NATSPubSub struct {
+	// connMu guards conn/js so Reconnect can swap both to a freshly
+	// dialed connection while Publish/Subscribe/SubscribeToUser keep
+	// running against whichever one is currently live.
+	connMu sync.RWMutex
+	conn   *nats.Conn
+	js     nats.JetStreamContext
+
+	stream string
+	nodeID string
+
+	subjectPrefix string
+	consumerName  string
+
+	handlers map[string]MessageHandler
+	mu       sync.RWMutex
+
+	// subs, subscribed and userSubs track everything active against the
+	// current conn/js so Reconnect can tear it down and re-create it
+	// identically against a freshly dialed connection.
+	subsMu     sync.Mutex
+	subs       []*nats.Subscription
+	subscribed bool
+	userSubs   map[string]MessageHandler
+
+	logger *zap.Logger
+}
+
+// NewNATSPubSub connects to NATS, ensures the configured JetStream
+// stream exists, and returns a ready-to-Subscribe PubSub backend.
+func NewNATSPubSub(cfg *config.Config, logger *zap.Logger) (*NATSPubSub, error) {
+	conn, js, err := dialNATS(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	subjectPrefix := cfg.Redis.PubSubChannelPrefix
+	if subjectPrefix == "" {
+		subjectPrefix = "ws-gateway"
+	}
+
+	ps := &NATSPubSub{
+		conn:          conn,
+		js:            js,
+		stream:        cfg.NATS.StreamName,
+		nodeID:        cfg.Cluster.NodeID,
+		subjectPrefix: subjectPrefix,
+		consumerName:  cfg.NATS.ConsumerName,
+		handlers:      make(map[string]MessageHandler),
+		userSubs:      make(map[string]MessageHandler),
+		logger:        logger,
+	}
+
+	if err := ps.ensureStream(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return ps, nil
+}
+
+// dialNATS connects to NATS per cfg.NATS.URLs and returns a JetStream
+// context, shared by NewNATSPubSub and Reconnect so both dial the same
+// way.
+func dialNATS(cfg *config.Config) (*nats.Conn, nats.JetStreamContext, error) {
+	conn, err := nats.Connect(strings.Join(cfg.NATS.URLs, ","),
+		nats.Name("websocket-gateway-"+cfg.Cluster.NodeID),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(time.Second),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("nats connect failed: %w", err)
+	}
+
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("nats jetstream context failed: %w", err)
+	}
+
+	return conn, js, nil
+}
+
+// jetStream returns the current JetStream context, safe to call
+// concurrently with Reconnect swapping it out.
+func (p *NATSPubSub) jetStream() nats.JetStreamContext {
+	p.connMu.RLock()
+	defer p.connMu.RUnlock()
+	return p.js
+}
+
+// Reconnect dials a fresh NATS connection using cfg's current
+// NATS.URLs, re-ensures the stream, and re-creates every subscription
+// that was active against the old connection (the shared durable
+// consumer, if Subscribe was called, and every active SubscribeToUser)
+// against the new one. The old connection is drained and closed only
+// after the new one is live, so Publish/PublishUserMessage never see a
+// nil connection mid-swap.
+func (p *NATSPubSub) Reconnect(cfg *config.Config) error {
+	conn, js, err := dialNATS(cfg)
+	if err != nil {
+		return err
+	}
+
+	p.connMu.Lock()
+	oldConn, oldJS := p.conn, p.js
+	p.conn = conn
+	p.js = js
+	p.connMu.Unlock()
+
+	if err := p.ensureStream(); err != nil {
+		// Roll back so Publish/Subscribe keep using the connection that
+		// actually has the stream on it.
+		p.connMu.Lock()
+		p.conn, p.js = oldConn, oldJS
+		p.connMu.Unlock()
+		conn.Close()
+		return err
+	}
+
+	p.subsMu.Lock()
+	wasSubscribed := p.subscribed
+	userSubs := make(map[string]MessageHandler, len(p.userSubs))
+	for userID, handler := range p.userSubs {
+		userSubs[userID] = handler
+	}
+	p.subs = nil
+	p.subsMu.Unlock()
+
+	if wasSubscribed {
+		if err := p.Subscribe(); err != nil {
+			return fmt.Errorf("nats reconnect: re-subscribing shared consumer: %w", err)
+		}
+	}
+	for userID, handler := range userSubs {
+		if err := p.SubscribeToUser(userID, handler); err != nil {
+			return fmt.Errorf("nats reconnect: re-subscribing user %q: %w", userID, err)
+		}
+	}
+
+	if err := oldConn.Drain(); err != nil {
+		p.logger.Warn("nats reconnect: failed to drain old connection", zap.Error(err))
+	}
+
+	p.logger.Info("nats pub/sub reconnected", zap.Strings("urls", cfg.NATS.URLs))
+	return nil
+}
+
+// ensureStream creates the JetStream stream backing every channel this
+// process publishes or subscribes to, if it doesn't already exist.
+func (p *NATSPubSub) ensureStream() error {
+	subjects := []string{fmt.Sprintf("%s.>", p.subjectPrefix)}
+
+	_, err := p.jetStream().AddStream(&nats.StreamConfig{
+		Name:      p.stream,
+		Subjects:  subjects,
+		Storage:   nats.FileStorage,
+		Retention: nats.LimitsPolicy,
+		MaxAge:    24 * time.Hour,
+	})
+	if err != nil && err != nats.ErrStreamNameAlreadyInUse {
+		return fmt.Errorf("nats add stream failed: %w", err)
+	}
+	return nil
+}
+
+func (p *NATSPubSub) messagesSubject() string {
+	return fmt.Sprintf("%s.messages", p.subjectPrefix)
+}
+
+func (p *NATSPubSub) userSubject(userID string) string {
+	return fmt.Sprintf("%s.user.%s", p.subjectPrefix, userID)
+}
+
+// Publish broadcasts msg on the shared messages subject.
+func (p *NATSPubSub) Publish(ctx context.Context, msg interface{}) error {
+	return p.publish(ctx, p.messagesSubject(), msg)
+}
+
+// PublishUserMessage delivers msg to whichever node holds an active
+// SubscribeToUser subscription on userID's per-user subject.
+func (p *NATSPubSub) PublishUserMessage(ctx context.Context, userID string, msg interface{}) error {
+	return p.publish(ctx, p.userSubject(userID), msg)
+}
+
+func (p *NATSPubSub) publish(ctx context.Context, subject string, msg interface{}) error {
+	envelopeBytes, err := envelope(p.nodeID, msg)
+	if err != nil {
+		return err
+	}
+
+	if _, err := p.jetStream().Publish(subject, envelopeBytes, nats.Context(ctx)); err != nil {
+		return fmt.Errorf("nats publish failed: %w", err)
+	}
+	return nil
+}
+
+// Subscribe starts a durable JetStream consumer on the shared messages
+// subject. Being durable, a message published while this node is down
+// is still delivered once it reconnects, unlike the Redis backend.
+func (p *NATSPubSub) Subscribe() error {
+	sub, err := p.jetStream().QueueSubscribe(p.messagesSubject(), p.consumerName, p.dispatch,
+		nats.Durable(p.consumerName),
+		nats.ManualAck(),
+		nats.AckExplicit(),
+	)
+	if err != nil {
+		return fmt.Errorf("nats subscribe failed: %w", err)
+	}
+
+	p.subsMu.Lock()
+	p.subs = append(p.subs, sub)
+	p.subscribed = true
+	p.subsMu.Unlock()
+
+	p.logger.Info("nats jetstream subscribed",
+		zap.String("subject", p.messagesSubject()),
+		zap.String("consumer", p.consumerName))
+
+	return nil
+}
+
+// RegisterHandler registers a handler for a message type on the shared
+// channel.
+func (p *NATSPubSub) RegisterHandler(msgType string, handler MessageHandler) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.handlers[msgType] = handler
+	p.logger.Debug("registered nats pub/sub handler", zap.String("message_type", msgType))
+}
+
+// SubscribeToUser starts an ephemeral (non-durable) push subscription
+// for a single user's subject, scoped to the lifetime of that user's
+// active connection on this node. It delivers only messages published
+// after the subscription starts (nats.DeliverNew()) -- without that, a
+// fresh ephemeral consumer defaults to replaying the whole retained
+// stream history for the subject on every reconnect.
+func (p *NATSPubSub) SubscribeToUser(userID string, handler MessageHandler) error {
+	sub, err := p.jetStream().Subscribe(p.userSubject(userID), func(natsMsg *nats.Msg) {
+		baseMsg, err := decodeEnvelope(p.nodeID, natsMsg.Data)
+		if err != nil {
+			p.logger.Error("failed to decode nats user message", zap.Error(err))
+			natsMsg.Ack()
+			return
+		}
+		if baseMsg == nil {
+			natsMsg.Ack() // published by this node, already delivered locally
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := handler(ctx, *baseMsg); err != nil {
+			p.logger.Error("nats user message handler failed", zap.Error(err))
+			if nakErr := natsMsg.Nak(); nakErr != nil {
+				p.logger.Warn("failed to nak nats user message", zap.Error(nakErr))
+			}
+			return
+		}
+		natsMsg.Ack()
+	}, nats.ManualAck(), nats.AckExplicit(), nats.DeliverNew())
+	if err != nil {
+		return fmt.Errorf("nats subscribe to user failed: %w", err)
+	}
+
+	p.subsMu.Lock()
+	p.subs = append(p.subs, sub)
+	p.userSubs[userID] = handler
+	p.subsMu.Unlock()
+
+	return nil
+}
+
+// dispatch is the JetStream message handler for the shared subject: it
+// decodes the envelope, looks up the registered handler for the inner
+// message's type, and acks only once the handler succeeds. A handler
+// error (or no registered handler, which is unexpected and likely a
+// node running stale code) leaves the message unacked so JetStream
+// redelivers it instead of silently losing it.
+func (p *NATSPubSub) dispatch(natsMsg *nats.Msg) {
+	baseMsg, err := decodeEnvelope(p.nodeID, natsMsg.Data)
+	if err != nil {
+		p.logger.Error("failed to decode nats message", zap.Error(err))
+		natsMsg.Ack()
+		return
+	}
+	if baseMsg == nil {
+		natsMsg.Ack()
+		return
+	}
+
+	p.mu.RLock()
+	handler, exists := p.handlers[baseMsg.Type]
+	p.mu.RUnlock()
+
+	if !exists {
+		p.logger.Debug("no handler for message type", zap.String("type", baseMsg.Type))
+		if err := natsMsg.Nak(); err != nil {
+			p.logger.Warn("failed to nak nats message", zap.Error(err))
+		}
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := handler(ctx, *baseMsg); err != nil {
+		p.logger.Error("nats message handler failed",
+			zap.String("type", baseMsg.Type), zap.Error(err))
+		if nakErr := natsMsg.Nak(); nakErr != nil {
+			p.logger.Warn("failed to nak nats message", zap.Error(nakErr))
+		}
+		return
+	}
+	natsMsg.Ack()
+}
+
+// Shutdown unsubscribes everything and drains the NATS connection so
+// in-flight acks are flushed before the process exits.
+func (p *NATSPubSub) Shutdown() {
+	p.logger.Info("shutting down nats pub/sub")
+
+	p.subsMu.Lock()
+	for _, sub := range p.subs {
+		if err := sub.Unsubscribe(); err != nil {
+			p.logger.Warn("failed to unsubscribe nats subscription", zap.Error(err))
+		}
+	}
+	p.subsMu.Unlock()
+
+	p.connMu.RLock()
+	conn := p.conn
+	p.connMu.RUnlock()
+
+	if err := conn.Drain(); err != nil {
+		p.logger.Error("failed to drain nats connection", zap.Error(err))
+	}
+
+	p.logger.Info("nats pub/sub shutdown complete")
+}
+
+// envelopeMessage mirrors the Redis backend's loop-prevention envelope.
+type envelopeMessage struct {
+	NodeID  string          `json:"node_id"`
+	Message json.RawMessage `json:"message"`
+}
+
+func envelope(nodeID string, msg interface{}) ([]byte, error) {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	return json.Marshal(envelopeMessage{NodeID: nodeID, Message: payload})
+}
+
+// decodeEnvelope unwraps an envelope, returning (nil, nil) if it
+// originated from this node (ownNodeID) so dispatch can skip it.
+func decodeEnvelope(ownNodeID string, raw []byte) (*protocol.BaseMessage, error) {
+	var env envelopeMessage
+	if err := json.Unmarshal(raw, &env); err != nil {
+		return nil, fmt.Errorf("failed to parse envelope: %w", err)
+	}
+	if env.NodeID == ownNodeID {
+		return nil, nil
+	}
+
+	var base protocol.BaseMessage
+	if err := json.Unmarshal(env.Message, &base); err != nil {
+		return nil, fmt.Errorf("failed to parse inner message: %w", err)
+	}
+	return &base, nil
+}
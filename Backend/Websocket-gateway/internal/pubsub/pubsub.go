@@ -0,0 +1,66 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"github.com/yourcompany/websocket-gateway/internal/config"
+)
+
+// PubSub is the cross-node fan-out backend the gateway routes messages
+// through: a node publishes locally-received traffic here, and every
+// other node's Subscribe loop re-delivers it to its own connected
+// clients. RedisPubSub and NATSPubSub are the two implementations.
+type PubSub interface {
+	// Publish broadcasts msg to every subscribed node on the shared
+	// channel (used for global/broadcast traffic such as presence).
+	Publish(ctx context.Context, msg interface{}) error
+
+	// Subscribe starts the background loop that dispatches received
+	// messages to handlers registered via RegisterHandler.
+	Subscribe() error
+
+	// RegisterHandler registers the callback invoked for a given
+	// protocol message type on the shared channel.
+	RegisterHandler(msgType string, handler MessageHandler)
+
+	// PublishUserMessage delivers msg to subscribers of a single user's
+	// channel, used to fan a point-to-point message out to whichever
+	// node holds that user's connection.
+	PublishUserMessage(ctx context.Context, userID string, msg interface{}) error
+
+	// SubscribeToUser starts a background loop delivering messages
+	// published to a single user's channel to handler.
+	SubscribeToUser(userID string, handler MessageHandler) error
+
+	// Reconnect re-establishes the backend's connection using cfg's
+	// current NATS/Redis credentials, re-creating the shared subscribe
+	// loop and every active per-user subscription against the new
+	// connection. Returns an error (leaving the existing connection in
+	// place) if the backend can't do this safely live.
+	Reconnect(cfg *config.Config) error
+
+	// Shutdown stops all subscriptions and releases the underlying
+	// connection.
+	Shutdown()
+}
+
+var _ PubSub = (*RedisPubSub)(nil)
+var _ PubSub = (*NATSPubSub)(nil)
+
+// New constructs the configured PubSub backend. Redis is the default:
+// simple at-most-once fan-out with no persistence if a node is briefly
+// unreachable. NATS JetStream trades that simplicity for durable,
+// at-least-once delivery backed by a replicated stream.
+func New(cfg *config.Config, logger *zap.Logger) (PubSub, error) {
+	switch cfg.PubSub.Backend {
+	case "", "redis":
+		return NewRedisPubSub(cfg, logger)
+	case "nats":
+		return NewNATSPubSub(cfg, logger)
+	default:
+		return nil, fmt.Errorf("pubsub: unknown backend %q", cfg.PubSub.Backend)
+	}
+}
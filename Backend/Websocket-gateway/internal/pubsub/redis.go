@@ -11,6 +11,7 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/yourcompany/websocket-gateway/internal/config"
+	"github.com/yourcompany/websocket-gateway/internal/redisconn"
 	"github.com/yourcompany/websocket-gateway/pkg/protocol"
 )
 
@@ -34,36 +35,15 @@ type RedisPubSub struct {
 
 type MessageHandler func(ctx context.Context, msg protocol.BaseMessage) error
 
-// NewRedisPubSub creates a new Redis Pub/Sub instance
+// NewRedisPubSub creates a new Redis Pub/Sub instance, reusing the
+// process-wide client from internal/redisconn rather than opening a
+// second pool against the same Redis deployment.
 func NewRedisPubSub(cfg *config.Config, logger *zap.Logger) (*RedisPubSub, error) {
-	// Create Redis client
-	var client redis.UniversalClient
-	
-	if len(cfg.Redis.Addresses) > 1 {
-		client = redis.NewClusterClient(&redis.ClusterOptions{
-			Addrs:        cfg.Redis.Addresses,
-			Password:     cfg.Redis.Password,
-			PoolSize:     cfg.Redis.PoolSize,
-			MinIdleConns: cfg.Redis.MinIdleConns,
-		})
-	} else {
-		client = redis.NewClient(&redis.Options{
-			Addr:         cfg.Redis.Addresses[0],
-			Password:     cfg.Redis.Password,
-			DB:           cfg.Redis.DB,
-			PoolSize:     cfg.Redis.PoolSize,
-			MinIdleConns: cfg.Redis.MinIdleConns,
-		})
-	}
-	
-	// Test connection
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	
-	if err := client.Ping(ctx).Err(); err != nil {
+	client, err := redisconn.Get(cfg)
+	if err != nil {
 		return nil, fmt.Errorf("redis connection failed: %w", err)
 	}
-	
+
 	ps := &RedisPubSub{
 		client:   client,
 		channel:  fmt.Sprintf("%s:messages", cfg.Redis.PubSubChannelPrefix),
@@ -233,21 +213,32 @@ func (r *RedisPubSub) SubscribeToUser(userID string, handler MessageHandler) err
 	return nil
 }
 
-// Shutdown gracefully shuts down the Pub/Sub
+// Shutdown stops this Pub/Sub's subscriptions. It deliberately does not
+// close the underlying Redis client: that client is shared (via
+// internal/redisconn) with other subsystems such as webpush and
+// backlog, so closing it here would break them out from under their
+// owners. The shared client is closed once, during process shutdown,
+// via redisconn.Close.
 func (r *RedisPubSub) Shutdown() {
 	r.logger.Info("shutting down redis pub/sub")
-	
+
 	r.cancel()
-	
+
 	if r.subscriber != nil {
 		r.subscriber.Close()
 	}
-	
+
 	r.wg.Wait()
-	
-	if err := r.client.Close(); err != nil {
-		r.logger.Error("failed to close redis client", zap.Error(err))
-	}
-	
+
 	r.logger.Info("redis pub/sub shutdown complete")
 }
+
+// Reconnect is not supported for the Redis backend: r.client is the
+// single process-wide client handed out by internal/redisconn and held
+// directly (not looked up live) by every other subsystem that uses
+// Redis (webpush, backlog, presence, connection's overflow spill), so
+// swapping it here would leave them all pointing at a closed client.
+// Rotating Redis credentials for this backend still requires a restart.
+func (r *RedisPubSub) Reconnect(cfg *config.Config) error {
+	return fmt.Errorf("pubsub: redis backend does not support live credential rotation; restart to apply")
+}
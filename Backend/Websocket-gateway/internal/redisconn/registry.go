@@ -0,0 +1,93 @@
+// Package redisconn hands out a single shared Redis client per process,
+// built from cfg.Redis on first use. internal/server constructs it once
+// via Get and passes the resulting client explicitly to every subsystem
+// that needs one (internal/pubsub's Redis backend calls Get itself;
+// internal/webpush, internal/backlog and internal/presence take it as a
+// constructor argument instead), so nothing opens a second connection
+// pool against the same cluster.
+//
+// This is a single process-wide singleton, not a registry keyed by
+// address or URI: every caller gets the same client regardless of what
+// cfg.Redis it's holding, and Close tears it down unconditionally. That
+// matches the gateway's current deployment, which only ever talks to one
+// Redis endpoint per process.
+package redisconn
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/yourcompany/websocket-gateway/internal/config"
+)
+
+var (
+	mu     sync.Mutex
+	client redis.UniversalClient
+)
+
+// Get returns the process-wide Redis client, creating and pinging it on
+// first use and reusing it for every subsequent caller regardless of
+// which subsystem asks first. cfg.Redis is assumed stable for the
+// lifetime of the process; a config change requires a restart, matching
+// how the rest of the gateway treats its config.
+func Get(cfg *config.Config) (redis.UniversalClient, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if client != nil {
+		return client, nil
+	}
+
+	if len(cfg.Redis.Addresses) == 0 {
+		return nil, fmt.Errorf("redisconn: no redis addresses configured")
+	}
+
+	var c redis.UniversalClient
+	if len(cfg.Redis.Addresses) > 1 {
+		c = redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:        cfg.Redis.Addresses,
+			Password:     cfg.Redis.Password,
+			PoolSize:     cfg.Redis.PoolSize,
+			MinIdleConns: cfg.Redis.MinIdleConns,
+		})
+	} else {
+		c = redis.NewClient(&redis.Options{
+			Addr:         cfg.Redis.Addresses[0],
+			Password:     cfg.Redis.Password,
+			DB:           cfg.Redis.DB,
+			PoolSize:     cfg.Redis.PoolSize,
+			MinIdleConns: cfg.Redis.MinIdleConns,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := c.Ping(ctx).Err(); err != nil {
+		return nil, fmt.Errorf("redisconn: connection failed: %w", err)
+	}
+
+	client = c
+	return client, nil
+}
+
+// Close releases the shared client. Since every caller shares the one
+// client, there is no refcounting: it is only safe to call during
+// process shutdown, after every subsystem holding a reference from Get
+// has stopped using it.
+func Close() error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if client == nil {
+		return nil
+	}
+
+	err := client.Close()
+	client = nil
+	return err
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+var proxyProtoV2Signature = []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+
+// proxyProtoListener wraps a net.Listener and, when Server.ProxyProtocolEnabled
+// is set, rewrites each accepted connection's RemoteAddr from the HAProxy
+// PROXY protocol header (v1 or v2) sent ahead of the real traffic. This
+// lets gateways sitting behind an L4 load balancer see the true client IP
+// before the HTTP upgrade even runs, rather than the balancer's.
+type proxyProtoListener struct {
+	net.Listener
+}
+
+func (l *proxyProtoListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	remoteAddr, err := readProxyProtoHeader(br)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy protocol: %w", err)
+	}
+
+	return &proxyProtoConn{Conn: conn, reader: br, remoteAddr: remoteAddr}, nil
+}
+
+// proxyProtoConn overrides RemoteAddr with the address parsed from the
+// PROXY protocol header, if one was present, while reading application
+// bytes through the same buffered reader so nothing consumed during
+// header detection is lost.
+type proxyProtoConn struct {
+	net.Conn
+	reader     *bufio.Reader
+	remoteAddr net.Addr
+}
+
+func (c *proxyProtoConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+func (c *proxyProtoConn) RemoteAddr() net.Addr {
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// readProxyProtoHeader detects and consumes a PROXY protocol v2 (binary)
+// or v1 (text) header at the start of the connection, returning the
+// client address it declares. A nil address with a nil error means no
+// address could be extracted (an UNKNOWN/LOCAL header, or a connection
+// that doesn't start with a recognized header at all) and the
+// connection's own RemoteAddr should be used instead.
+func readProxyProtoHeader(br *bufio.Reader) (net.Addr, error) {
+	sig, err := br.Peek(len(proxyProtoV2Signature))
+	if err == nil && string(sig) == string(proxyProtoV2Signature) {
+		return readProxyProtoV2(br)
+	}
+	return readProxyProtoV1(br)
+}
+
+// readProxyProtoV1 parses the ASCII v1 header:
+// "PROXY <TCP4|TCP6|UNKNOWN> <src addr> <dst addr> <src port> <dst port>\r\n"
+func readProxyProtoV1(br *bufio.Reader) (net.Addr, error) {
+	peek, err := br.Peek(6)
+	if err != nil || string(peek) != "PROXY " {
+		return nil, nil
+	}
+
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("reading v1 header: %w", err)
+	}
+	line = strings.TrimRight(line, "\r\n")
+
+	fields := strings.Fields(line)
+	if len(fields) < 2 || fields[0] != "PROXY" {
+		return nil, fmt.Errorf("malformed v1 header: %q", line)
+	}
+	if fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) < 6 {
+		return nil, fmt.Errorf("malformed v1 header: %q", line)
+	}
+
+	ip := net.ParseIP(fields[2])
+	if ip == nil {
+		return nil, fmt.Errorf("malformed v1 source address: %q", fields[2])
+	}
+
+	port, err := strconv.Atoi(fields[4])
+	if err != nil {
+		return nil, fmt.Errorf("malformed v1 source port: %w", err)
+	}
+
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
+
+// readProxyProtoV2 parses the binary v2 header: a 12-byte signature
+// (already matched by the caller), a version/command byte, an address
+// family/protocol byte, a 2-byte big-endian address block length, and the
+// address block itself.
+func readProxyProtoV2(br *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, fmt.Errorf("reading v2 header: %w", err)
+	}
+
+	verCmd := header[12]
+	if verCmd>>4 != 0x2 {
+		return nil, fmt.Errorf("unsupported proxy protocol version: %#x", verCmd)
+	}
+
+	family := header[13]
+	length := binary.BigEndian.Uint16(header[14:16])
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(br, payload); err != nil {
+		return nil, fmt.Errorf("reading v2 address block: %w", err)
+	}
+
+	// Command 0x0 is LOCAL: a health check from the balancer itself,
+	// carrying no real client address.
+	if verCmd&0x0F == 0x0 {
+		return nil, nil
+	}
+
+	switch family {
+	case 0x11: // TCP over IPv4
+		if len(payload) < 12 {
+			return nil, fmt.Errorf("short v2 IPv4 address block")
+		}
+		return &net.TCPAddr{
+			IP:   net.IP(payload[0:4]),
+			Port: int(binary.BigEndian.Uint16(payload[8:10])),
+		}, nil
+	case 0x21: // TCP over IPv6
+		if len(payload) < 36 {
+			return nil, fmt.Errorf("short v2 IPv6 address block")
+		}
+		return &net.TCPAddr{
+			IP:   net.IP(payload[0:16]),
+			Port: int(binary.BigEndian.Uint16(payload[32:34])),
+		}, nil
+	default:
+		// Unix sockets and unspecified families carry no usable IP.
+		return nil, nil
+	}
+}
@@ -2,20 +2,32 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 	"golang.org/x/time/rate"
 
+	"github.com/yourcompany/websocket-gateway/internal/backlog"
+	"github.com/yourcompany/websocket-gateway/internal/cluster"
 	"github.com/yourcompany/websocket-gateway/internal/config"
 	"github.com/yourcompany/websocket-gateway/internal/connection"
+	"github.com/yourcompany/websocket-gateway/internal/connection/faultinject"
 	"github.com/yourcompany/websocket-gateway/internal/messaging"
 	"github.com/yourcompany/websocket-gateway/internal/metrics"
+	"github.com/yourcompany/websocket-gateway/internal/presence"
 	"github.com/yourcompany/websocket-gateway/internal/pubsub"
+	"github.com/yourcompany/websocket-gateway/internal/redisconn"
+	"github.com/yourcompany/websocket-gateway/internal/webpush"
+	"github.com/yourcompany/websocket-gateway/pkg/protocol"
 )
 
 // WebSocketServer represents the WebSocket gateway server
@@ -27,22 +39,55 @@ type WebSocketServer struct {
 	messageRouter *messaging.Router
 	metrics       *metrics.MetricsCollector
 	pubSub        pubsub.PubSub
-	
+
+	// clusterRegistry is this node's Raft participant tracking which
+	// node owns each connected user, nil unless cfg.Cluster.RaftBindAddr
+	// is set.
+	clusterRegistry *cluster.Registry
+
+	// webpushManager delivers offline push notifications, nil unless
+	// cfg.WebPush.Enabled and VAPID keys are configured.
+	webpushManager *webpush.Manager
+
+	// presenceManager tracks per-device online/offline state and fans out
+	// status changes to a user's other connected devices and nodes.
+	presenceManager *presence.Manager
+
+	// bgCancel stops the webpushManager pruning/recheck loops on shutdown.
+	bgCancel context.CancelFunc
+
+	// trustedProxies are the CIDRs allowed to set X-Forwarded-For/Forwarded;
+	// getClientIP only trusts those headers up to the first hop outside this
+	// set. Guarded by trustedProxiesMu since config reload can replace it
+	// while requests are reading it concurrently.
+	trustedProxiesMu sync.RWMutex
+	trustedProxies   []*net.IPNet
+
+	// ipLimiter enforces RateLimit.ConnectionsPerIP{Window,Limit} cluster-wide via Redis.
+	ipLimiter *connection.SlidingWindowCounter
+
+	// configManager applies SIGHUP / config-file-change reloads to config
+	// in place, live-updating the safe subset of settings without
+	// dropping connections.
+	configManager *config.Manager
+
 	// HTTP server
 	httpServer    *http.Server
-	
+
 	// Shutdown coordination
 	shutdownOnce  sync.Once
 	shutdownChan  chan struct{}
 }
 
-// NewWebSocketServer creates a new WebSocket server
-func NewWebSocketServer(cfg *config.Config, logger *zap.Logger) (*WebSocketServer, error) {
+// NewWebSocketServer creates a new WebSocket server. logLevel is the
+// atomic level backing logger, exposed read/write over the metrics
+// server's /loglevel endpoint so verbosity can change without a restart.
+func NewWebSocketServer(cfg *config.Config, logger *zap.Logger, logLevel zap.AtomicLevel) (*WebSocketServer, error) {
 	// Create connection manager
 	connManager := connection.NewManager(cfg, logger)
 	
-	// Create Pub/Sub (Redis)
-	pubSub, err := pubsub.NewRedisPubSub(cfg, logger)
+	// Create Pub/Sub backend (Redis or NATS JetStream, per cfg.PubSub.Backend)
+	pubSub, err := pubsub.New(cfg, logger)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create pub/sub: %w", err)
 	}
@@ -54,14 +99,83 @@ func NewWebSocketServer(cfg *config.Config, logger *zap.Logger) (*WebSocketServe
 	
 	// Create message router
 	router := messaging.NewRouter(connManager, pubSub, logger, cfg.Cluster.NodeID)
-	
+
+	trustedProxies, err := parseTrustedProxies(cfg.Server.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted_proxies: %w", err)
+	}
+
+	redisClient, err := redisconn.Get(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+	ipLimiter := connection.NewSlidingWindowCounter(
+		redisClient,
+		fmt.Sprintf("%s:ip-conn-limit", cfg.Redis.PubSubChannelPrefix),
+		cfg.RateLimit.ConnectionsPerIPWindow,
+		cfg.RateLimit.ConnectionsPerIPLimit,
+	)
+	connManager.SetOutboundRedisClient(redisClient)
+
+	// Chaos-testing harness: wraps new connections per the active
+	// scenarios and exposes /debug/faults, only if explicitly enabled.
+	var faultInjector *faultinject.Injector
+	if cfg.Observability.FaultInjectionEnabled {
+		faultInjector = faultinject.NewInjector(logger)
+		connManager.SetTransportDecorator(faultInjector)
+	}
+
+	// Cluster ownership registry, so SendToUser can tell a genuinely
+	// offline user apart from one connected to a different node.
+	// Optional: a gateway can run single-node with raft_bind_addr unset.
+	var clusterRegistry *cluster.Registry
+	if cfg.Cluster.RaftBindAddr != "" {
+		clusterRegistry, err = cluster.NewRegistry(cfg, fmt.Sprintf(":%d", cfg.Observability.MetricsPort), logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to start cluster registry: %w", err)
+		}
+		connManager.SetClusterRegistry(clusterRegistry)
+	}
+
+	// Reconnect backlog replay, so a client that dropped and reconnects
+	// with a last_message_id doesn't miss anything sent while it was away.
+	backlogManager := backlog.NewManager(cfg, redisClient, logger)
+	connManager.SetBacklogReplayer(backlogManager)
+
+	// Presence/typing tracking, so a device connecting or disconnecting
+	// is reflected to the user's other devices and to anyone subscribed
+	// to their status, across nodes.
+	presenceManager := presence.NewManager(cfg, redisClient, logger)
+	connManager.SetPresenceNotifier(presenceManager)
+
+	bgCtx, bgCancel := context.WithCancel(context.Background())
+
+	// Web Push fallback for users with no active WebSocket connection
+	// anywhere in the cluster. Optional: nil unless cfg.WebPush.Enabled
+	// and VAPID keys are configured.
+	webpushManager, err := webpush.NewManager(cfg, webpush.NewRedisStore(redisClient, cfg.Redis.PubSubChannelPrefix), logger)
+	if err != nil {
+		if !errors.Is(err, webpush.ErrNotConfigured) {
+			bgCancel()
+			return nil, fmt.Errorf("failed to start webpush manager: %w", err)
+		}
+		webpushManager = nil
+	} else {
+		connManager.SetPushFallback(webpushManager)
+		go webpushManager.StartPruning(bgCtx)
+		go webpushManager.StartRecheck(bgCtx)
+	}
+
 	// Create metrics collector
 	metricsCollector := metrics.NewMetricsCollector(
 		cfg.Observability.MetricsPort,
 		connManager,
+		logLevel,
+		faultInjector,
+		clusterRegistry,
 		logger,
 	)
-	
+
 	// Configure WebSocket upgrader
 	upgrader := websocket.Upgrader{
 		ReadBufferSize:  cfg.Server.ReadBufferSize,
@@ -70,7 +184,8 @@ func NewWebSocketServer(cfg *config.Config, logger *zap.Logger) (*WebSocketServe
 			// In production, implement proper origin checking
 			return true
 		},
-		EnableCompression: true,
+		EnableCompression: cfg.Server.EnablePermessageDeflate,
+		Subprotocols:      protocol.SupportedProtocols,
 	}
 	
 	server := &WebSocketServer{
@@ -81,15 +196,89 @@ func NewWebSocketServer(cfg *config.Config, logger *zap.Logger) (*WebSocketServe
 		messageRouter: router,
 		metrics:       metricsCollector,
 		pubSub:        pubSub,
+		clusterRegistry: clusterRegistry,
+		webpushManager:  webpushManager,
+		presenceManager: presenceManager,
+		bgCancel:        bgCancel,
+		trustedProxies: trustedProxies,
+		ipLimiter:     ipLimiter,
 		shutdownChan:  make(chan struct{}),
 	}
-	
+
+	// configManager reloads cfg's safe-reloadable fields in place on
+	// SIGHUP or a config file change, without dropping connections.
+	// Everything it touches -- connManager.config, server.config -- is the
+	// same pointer, so a reload takes effect the next time each field is
+	// read through configManager.Get(); the derived state below (log level,
+	// trusted proxies, per-client rate limiters, pub/sub connection) needs
+	// its own callback.
+	server.configManager = config.NewManager(cfg, logger)
+	connManager.SetConfigManager(server.configManager)
+	server.configManager.OnChange(func(old, new *config.Config) {
+		if new.Observability.LogLevel != old.Observability.LogLevel {
+			if level, err := zapcore.ParseLevel(new.Observability.LogLevel); err != nil {
+				logger.Warn("config reload: invalid log_level, leaving current level in place",
+					zap.String("log_level", new.Observability.LogLevel), zap.Error(err))
+			} else {
+				logLevel.SetLevel(level)
+			}
+		}
+
+		if !stringSlicesEqual(old.Server.TrustedProxies, new.Server.TrustedProxies) {
+			proxies, err := parseTrustedProxies(new.Server.TrustedProxies)
+			if err != nil {
+				logger.Warn("config reload: invalid trusted_proxies, leaving current list in place", zap.Error(err))
+				return
+			}
+			server.trustedProxiesMu.Lock()
+			server.trustedProxies = proxies
+			server.trustedProxiesMu.Unlock()
+		}
+
+		if old.RateLimit.MessagesPerSecond != new.RateLimit.MessagesPerSecond || old.RateLimit.Burst != new.RateLimit.Burst {
+			connManager.RebuildRateLimiters(rate.Limit(new.RateLimit.MessagesPerSecond), new.RateLimit.Burst)
+			logger.Info("config reload: rebuilt rate limiters for connected clients",
+				zap.Int("messages_per_second", new.RateLimit.MessagesPerSecond),
+				zap.Int("burst", new.RateLimit.Burst))
+		}
+
+		if !stringSlicesEqual(old.NATS.URLs, new.NATS.URLs) ||
+			!stringSlicesEqual(old.Redis.Addresses, new.Redis.Addresses) ||
+			old.Redis.Password != new.Redis.Password || old.Redis.DB != new.Redis.DB {
+			if err := pubSub.Reconnect(new); err != nil {
+				logger.Error("config reload: failed to reconnect pub/sub backend to new NATS/Redis credentials, keeping old connection",
+					zap.Error(err))
+			} else {
+				logger.Info("config reload: reconnected pub/sub backend to updated NATS/Redis credentials")
+			}
+		}
+	})
+
 	// Register handlers
 	server.registerHandlers()
-	
+
 	return server, nil
 }
 
+func stringSlicesEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// liveConfig returns a consistent, race-free snapshot of config fields
+// Reload can mutate concurrently with a request in flight.
+func (s *WebSocketServer) liveConfig() *config.Config {
+	cfg := s.configManager.Get()
+	return &cfg
+}
+
 // registerHandlers registers connection manager handlers
 func (s *WebSocketServer) registerHandlers() {
 	s.connManager.RegisterHandlers(
@@ -117,11 +306,6 @@ func (s *WebSocketServer) handleDisconnect(client *connection.Client, reason str
 		zap.String("reason", reason),
 		zap.Duration("duration", time.Since(client.ConnectedAt)))
 	
-	if client.UserID != "" {
-		// Publish offline status
-		s.publishPresence(client.UserID, "offline", client.DeviceID)
-	}
-	
 	s.metrics.RecordDisconnection(reason)
 }
 
@@ -130,34 +314,45 @@ func (s *WebSocketServer) handleMessage(client *connection.Client, message []byt
 	return s.messageRouter.HandleMessage(client, message)
 }
 
-// ServeHTTP handles HTTP requests and upgrades to WebSocket
-func (s *WebSocketServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+// handleWebSocketUpgrade handles HTTP requests and upgrades to WebSocket.
+func (s *WebSocketServer) handleWebSocketUpgrade(w http.ResponseWriter, r *http.Request) {
 	// Extract client IP
-	ip := getClientIP(r)
-	
+	ip := s.getClientIP(r)
+
 	// Check connection limits per IP
 	if !s.checkIPLimit(ip) {
 		http.Error(w, "too many connections from this IP", http.StatusTooManyRequests)
 		return
 	}
-	
+
 	// Upgrade to WebSocket
 	conn, err := s.upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		s.logger.Error("failed to upgrade connection", 
+		s.logger.Error("failed to upgrade connection",
 			zap.Error(err),
 			zap.String("ip", ip))
 		return
 	}
-	
+
 	// Create rate limiter for this connection
+	rlCfg := s.liveConfig().RateLimit
 	rateLimiter := rate.NewLimiter(
-		rate.Limit(s.config.RateLimit.MessagesPerSecond),
-		s.config.RateLimit.Burst,
+		rate.Limit(rlCfg.MessagesPerSecond),
+		rlCfg.Burst,
 	)
-	
+
+	// Resolve the codec the client negotiated via Sec-WebSocket-Protocol,
+	// defaulting to JSON for clients that don't ask for anything else.
+	codec, ok := protocol.CodecByProtocol(conn.Subprotocol())
+	if !ok {
+		codec = protocol.JSON
+	}
+	if s.config.Server.EnablePermessageDeflate {
+		conn.SetCompressionLevel(s.config.Server.CompressionLevel)
+	}
+
 	// Add to connection manager
-	_, err = s.connManager.AddConnection(conn, ip, rateLimiter, s.config.RateLimit.Burst)
+	_, err = s.connManager.AddConnection(connection.NewWebSocketTransport(conn), ip, rateLimiter, rlCfg.Burst, codec)
 	if err != nil {
 		s.logger.Error("failed to add connection",
 			zap.Error(err),
@@ -167,22 +362,351 @@ func (s *WebSocketServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// checkIPLimit checks if IP has exceeded connection limit
+// handleSSEConnect establishes a Server-Sent Events stream as a fallback
+// transport for clients behind proxies that break WebSocket upgrades. The
+// first event delivered is a "connected" event carrying the new client_id,
+// which the client must echo back as a query parameter on /sse/send.
+func (s *WebSocketServer) handleSSEConnect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ip := s.getClientIP(r)
+	if !s.checkIPLimit(ip) {
+		http.Error(w, "too many connections from this IP", http.StatusTooManyRequests)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	transport := connection.NewSSETransport(w, flusher)
+
+	rlCfg := s.liveConfig().RateLimit
+	rateLimiter := rate.NewLimiter(
+		rate.Limit(rlCfg.MessagesPerSecond),
+		rlCfg.Burst,
+	)
+
+	client, err := s.connManager.AddConnection(transport, ip, rateLimiter, rlCfg.Burst, protocol.JSON)
+	if err != nil {
+		s.logger.Error("failed to add SSE connection", zap.Error(err), zap.String("ip", ip))
+		http.Error(w, "failed to establish connection", http.StatusServiceUnavailable)
+		return
+	}
+
+	fmt.Fprintf(w, "event: connected\ndata: {\"client_id\":%q}\n\n", client.ID)
+	flusher.Flush()
+
+	<-r.Context().Done()
+}
+
+// handleSSESend accepts a client->server message for an SSE client,
+// identified by the client_id the connect handshake handed out, and feeds
+// it into that client's ReadPump.
+func (s *WebSocketServer) handleSSESend(w http.ResponseWriter, r *http.Request) {
+	s.handleTransportSend(w, r)
+}
+
+// handleLongPollConnect establishes a new long-poll client and returns its
+// client_id, which the client must present on every subsequent /longpoll/poll
+// and /longpoll/send call.
+func (s *WebSocketServer) handleLongPollConnect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ip := s.getClientIP(r)
+	if !s.checkIPLimit(ip) {
+		http.Error(w, "too many connections from this IP", http.StatusTooManyRequests)
+		return
+	}
+
+	transport := connection.NewLongPollTransport()
+
+	rlCfg := s.liveConfig().RateLimit
+	rateLimiter := rate.NewLimiter(
+		rate.Limit(rlCfg.MessagesPerSecond),
+		rlCfg.Burst,
+	)
+
+	client, err := s.connManager.AddConnection(transport, ip, rateLimiter, rlCfg.Burst, protocol.JSON)
+	if err != nil {
+		s.logger.Error("failed to add long-poll connection", zap.Error(err), zap.String("ip", ip))
+		http.Error(w, "failed to establish connection", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, "{\"client_id\":%q}", client.ID)
+}
+
+// handleLongPollPoll blocks for up to LongPollMaxWait for queued outbound
+// messages for the given client_id, then returns whatever's queued (which
+// may be empty, on timeout) as a JSON array of base64-less raw message
+// strings joined by the protocol's own framing.
+func (s *WebSocketServer) handleLongPollPoll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	client := s.clientFromRequest(w, r)
+	if client == nil {
+		return
+	}
+
+	messages, _ := client.PollOutbound(s.config.Server.LongPollMaxWait)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte("["))
+	for i, msg := range messages {
+		if i > 0 {
+			w.Write([]byte(","))
+		}
+		w.Write(msg)
+	}
+	w.Write([]byte("]"))
+}
+
+// handleLongPollSend accepts a client->server message for a long-poll
+// client, identified by its client_id, and feeds it into that client's
+// ReadPump.
+func (s *WebSocketServer) handleLongPollSend(w http.ResponseWriter, r *http.Request) {
+	s.handleTransportSend(w, r)
+}
+
+// handleTransportSend is shared by the SSE and long-poll send endpoints:
+// both deliver a raw message body to the named client's Feed method.
+func (s *WebSocketServer) handleTransportSend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	client := s.clientFromRequest(w, r)
+	if client == nil {
+		return
+	}
+
+	defer r.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1024*1024))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+
+	if err := client.Feed(body); err != nil {
+		http.Error(w, "failed to deliver message", http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// clientFromRequest resolves the client_id query parameter to a connected
+// client, writing an error response and returning nil if it's missing or unknown.
+func (s *WebSocketServer) clientFromRequest(w http.ResponseWriter, r *http.Request) *connection.Client {
+	clientID := r.URL.Query().Get("client_id")
+	if clientID == "" {
+		http.Error(w, "missing client_id", http.StatusBadRequest)
+		return nil
+	}
+
+	client := s.connManager.GetClient(clientID)
+	if client == nil {
+		http.Error(w, "unknown client_id", http.StatusNotFound)
+		return nil
+	}
+
+	return client
+}
+
+// buildMux wires up the HTTP routes for every transport enabled in
+// config.Server.EnabledTransports, so corporate proxies and mobile networks
+// that break WebSocket upgrades can still fall back to SSE or long-polling.
+func (s *WebSocketServer) buildMux() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	enabled := make(map[string]bool, len(s.config.Server.EnabledTransports))
+	for _, t := range s.config.Server.EnabledTransports {
+		enabled[t] = true
+	}
+
+	if enabled["websocket"] {
+		mux.HandleFunc("/", s.handleWebSocketUpgrade)
+	}
+
+	if enabled["sse"] {
+		mux.HandleFunc("/sse/connect", s.handleSSEConnect)
+		mux.HandleFunc("/sse/send", s.handleSSESend)
+	}
+
+	if enabled["longpoll"] {
+		mux.HandleFunc("/longpoll/connect", s.handleLongPollConnect)
+		mux.HandleFunc("/longpoll/poll", s.handleLongPollPoll)
+		mux.HandleFunc("/longpoll/send", s.handleLongPollSend)
+	}
+
+	return mux
+}
+
+// checkIPLimit reports whether ip is still within its cluster-wide sliding
+// window connection limit. A limiter error fails open so a transient
+// Redis problem degrades to the per-process IPRateLimiter instead of
+// rejecting every new connection gateway-wide.
 func (s *WebSocketServer) checkIPLimit(ip string) bool {
-	// This would be implemented with a sliding window counter
-	// For simplicity, we're using the connection manager's rate limiter
-	return true
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	allowed, err := s.ipLimiter.Allow(ctx, ip)
+	if err != nil {
+		s.logger.Warn("ip sliding window limiter check failed, failing open",
+			zap.Error(err),
+			zap.String("ip", ip))
+	}
+
+	return allowed
 }
 
-// getClientIP extracts the client IP from the request
-func getClientIP(r *http.Request) string {
-	// Check X-Forwarded-For header first (if behind proxy)
-	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
-		return forwarded
+// getClientIP determines the real client IP for an incoming request. A
+// naively-trusted X-Forwarded-For (or Forwarded) header lets any client
+// spoof its source IP, which defeats per-IP rate limiting. Instead we
+// start from the immediate TCP peer and, only if it's inside a configured
+// trusted-proxy CIDR, walk the forwarded chain right-to-left, stopping at
+// -- and returning -- the first hop that isn't itself trusted. If every
+// hop is trusted, the oldest (leftmost) hop is the real client.
+func (s *WebSocketServer) getClientIP(r *http.Request) string {
+	peerIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		peerIP = r.RemoteAddr
 	}
-	
-	// Fall back to remote address
-	return r.RemoteAddr
+
+	s.trustedProxiesMu.RLock()
+	defer s.trustedProxiesMu.RUnlock()
+	trusted := len(s.trustedProxies) > 0 && s.isTrustedProxy(peerIP)
+
+	if !trusted {
+		return peerIP
+	}
+
+	chain := forwardedChain(r)
+	for i := len(chain) - 1; i >= 0; i-- {
+		if !s.isTrustedProxy(chain[i]) {
+			return chain[i]
+		}
+	}
+
+	if len(chain) > 0 {
+		return chain[0]
+	}
+
+	return peerIP
+}
+
+func (s *WebSocketServer) isTrustedProxy(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, cidr := range s.trustedProxies {
+		if cidr.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedChain returns the hop-by-hop client IP chain declared by the
+// request, oldest hop first: the RFC 7239 Forwarded header if present,
+// else X-Forwarded-For.
+func forwardedChain(r *http.Request) []string {
+	if forwarded := r.Header.Get("Forwarded"); forwarded != "" {
+		return parseForwardedHeader(forwarded)
+	}
+
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		parts := strings.Split(xff, ",")
+		chain := make([]string, 0, len(parts))
+		for _, p := range parts {
+			chain = append(chain, strings.TrimSpace(p))
+		}
+		return chain
+	}
+
+	return nil
+}
+
+// parseForwardedHeader extracts the "for=" identifiers from an RFC 7239
+// Forwarded header, in the order they appear (oldest hop first), stripping
+// quotes, IPv6 brackets, and trailing port numbers.
+func parseForwardedHeader(header string) []string {
+	var chain []string
+	for _, hop := range strings.Split(header, ",") {
+		for _, directive := range strings.Split(hop, ";") {
+			directive = strings.TrimSpace(directive)
+			if len(directive) < 4 || !strings.EqualFold(directive[:4], "for=") {
+				continue
+			}
+			chain = append(chain, parseForwardedFor(directive[4:]))
+		}
+	}
+	return chain
+}
+
+// parseForwardedFor normalizes a single Forwarded "for=" value to a bare
+// IP, stripping surrounding quotes, IPv6 brackets, and a trailing port.
+func parseForwardedFor(value string) string {
+	value = strings.Trim(strings.TrimSpace(value), `"`)
+
+	if strings.HasPrefix(value, "[") {
+		if end := strings.Index(value, "]"); end != -1 {
+			return value[1:end]
+		}
+	}
+
+	// A bare IPv6 address contains more than one colon; only strip a
+	// trailing ":<port>" for IPv4 (or an obfuscated/opaque) identifier.
+	if strings.Count(value, ":") == 1 {
+		if idx := strings.LastIndex(value, ":"); idx != -1 {
+			value = value[:idx]
+		}
+	}
+
+	return value
+}
+
+// parseTrustedProxies parses a list of CIDR strings (a bare IP is treated
+// as a /32 or /128) into the IPNets getClientIP checks hops against.
+func parseTrustedProxies(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, raw := range cidrs {
+		entry := raw
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", raw, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
 }
 
 // Start starts the WebSocket server
@@ -190,7 +714,7 @@ func (s *WebSocketServer) Start() error {
 	// Create HTTP server
 	s.httpServer = &http.Server{
 		Addr:         fmt.Sprintf("%s:%d", s.config.Server.Host, s.config.Server.Port),
-		Handler:      s,
+		Handler:      s.buildMux(),
 		ReadTimeout:  s.config.Server.WriteWait,
 		WriteTimeout: s.config.Server.WriteWait,
 	}
@@ -201,12 +725,25 @@ func (s *WebSocketServer) Start() error {
 	
 	// Start metrics updater
 	go s.updateMetrics()
-	
+
+	// Watch for SIGHUP / config file changes and hot-reload in place
+	s.configManager.Watch(s.shutdownChan)
+
+	listener, err := net.Listen("tcp", s.httpServer.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+
+	if s.config.Server.ProxyProtocolEnabled {
+		s.logger.Info("PROXY protocol enabled on listener")
+		listener = &proxyProtoListener{Listener: listener}
+	}
+
 	// Start server
-	if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	if err := s.httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
 		return fmt.Errorf("failed to start server: %w", err)
 	}
-	
+
 	return nil
 }
 
@@ -252,30 +789,24 @@ func (s *WebSocketServer) Shutdown() {
 		
 		// Shutdown Pub/Sub
 		s.pubSub.Shutdown()
-		
+
 		// Shutdown metrics
 		s.metrics.Shutdown()
-		
+
+		// Leave the raft cluster, if participating
+		if s.clusterRegistry != nil {
+			s.clusterRegistry.Shutdown()
+		}
+
+		s.presenceManager.Shutdown()
+
+		s.bgCancel()
+
+		// Every subsystem sharing the redisconn client has stopped above.
+		if err := redisconn.Close(); err != nil {
+			s.logger.Error("failed to close shared redis client", zap.Error(err))
+		}
+
 		s.logger.Info("graceful shutdown complete")
 	})
 }
-
-// publishPresence publishes presence updates
-func (s *WebSocketServer) publishPresence(userID, status, deviceID string) {
-	presence := map[string]interface{}{
-		"type":      "presence",
-		"user_id":   userID,
-		"status":    status,
-		"device_id": deviceID,
-		"timestamp": time.Now().UnixMilli(),
-	}
-	
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	
-	if err := s.pubSub.Publish(ctx, presence); err != nil {
-		s.logger.Error("failed to publish presence", 
-			zap.Error(err),
-			zap.String("user_id", userID))
-	}
-}
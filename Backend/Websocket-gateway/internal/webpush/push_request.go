@@ -0,0 +1,89 @@
+package webpush
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// newPushRequest builds the HTTP request for a single Web Push delivery,
+// signing a VAPID JWT (RFC 8292) for the Authorization header. Message
+// content encryption (RFC 8291, aes128gcm) is applied to payload before
+// it reaches the push service; an empty payload is sent as a silent
+// wake-up ping used by the periodic subscription recheck.
+func newPushRequest(ctx context.Context, sub Subscription, payload []byte, subject, publicKeyB64, privateKeyB64 string) (*http.Request, error) {
+	body, err := encryptPayload(payload, sub.P256dh, sub.Auth)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt payload: %w", err)
+	}
+
+	token, err := signVAPIDJWT(sub.Endpoint, subject, privateKeyB64)
+	if err != nil {
+		return nil, fmt.Errorf("sign vapid jwt: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("TTL", "2419200") // 28 days; not tied to webpush.expired_grace_period
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Authorization", fmt.Sprintf("vapid t=%s, k=%s", token, publicKeyB64))
+
+	return req, nil
+}
+
+// signVAPIDJWT produces a short-lived ES256 JWT asserting the gateway's
+// identity to the push service, as required by RFC 8292.
+func signVAPIDJWT(endpoint, subject, privateKeyB64 string) (string, error) {
+	key, err := parseVAPIDPrivateKey(privateKeyB64)
+	if err != nil {
+		return "", err
+	}
+
+	aud, err := pushServiceAudience(endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	claims := jwt.RegisteredClaims{
+		Audience:  jwt.ClaimStrings{aud},
+		Subject:   subject,
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(12 * time.Hour)),
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodES256, claims).SignedString(key)
+}
+
+func parseVAPIDPrivateKey(privateKeyB64 string) (*ecdsa.PrivateKey, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(privateKeyB64)
+	if err != nil {
+		return nil, fmt.Errorf("decode vapid private key: %w", err)
+	}
+
+	key, err := x509.ParseECPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parse vapid private key: %w", err)
+	}
+	if key.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("vapid private key must use P-256")
+	}
+
+	return key, nil
+}
+
+// encryptPayload applies the aes128gcm content-encoding from RFC 8291. It
+// is implemented in crypto.go.
+func encryptPayload(payload []byte, p256dhB64, authB64 string) ([]byte, error) {
+	return aes128gcmEncrypt(payload, p256dhB64, authB64)
+}
@@ -0,0 +1,196 @@
+package webpush
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore persists Web Push subscriptions in Redis, keyed by user ID.
+// Each user maps to a hash of endpoint -> encoded Subscription, which
+// keeps per-user lookups and multi-device fan-out to O(devices).
+type RedisStore struct {
+	client    redis.UniversalClient
+	keyPrefix string
+}
+
+// NewRedisStore creates a subscription store on top of an existing Redis
+// client, reusing the prefix convention established by internal/pubsub.
+func NewRedisStore(client redis.UniversalClient, keyPrefix string) *RedisStore {
+	return &RedisStore{client: client, keyPrefix: keyPrefix}
+}
+
+func (s *RedisStore) userKey(userID string) string {
+	return fmt.Sprintf("%s:webpush:subs:%s", s.keyPrefix, userID)
+}
+
+func (s *RedisStore) indexKey() string {
+	return fmt.Sprintf("%s:webpush:subs:index", s.keyPrefix)
+}
+
+type storedSubscription struct {
+	UserID    string     `json:"user_id"`
+	Endpoint  string     `json:"endpoint"`
+	P256dh    string     `json:"p256dh"`
+	Auth      string     `json:"auth"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiredAt *time.Time `json:"expired_at,omitempty"`
+}
+
+func toStored(sub Subscription) storedSubscription {
+	return storedSubscription{
+		UserID:    sub.UserID,
+		Endpoint:  sub.Endpoint,
+		P256dh:    sub.P256dh,
+		Auth:      sub.Auth,
+		CreatedAt: sub.CreatedAt,
+		ExpiredAt: sub.ExpiredAt,
+	}
+}
+
+func fromStored(s storedSubscription) Subscription {
+	return Subscription{
+		UserID:    s.UserID,
+		Endpoint:  s.Endpoint,
+		P256dh:    s.P256dh,
+		Auth:      s.Auth,
+		CreatedAt: s.CreatedAt,
+		ExpiredAt: s.ExpiredAt,
+	}
+}
+
+// Save upserts a subscription, clearing any prior expiry so a
+// re-registration brings a stale subscription back to life.
+func (s *RedisStore) Save(ctx context.Context, sub Subscription) error {
+	sub.ExpiredAt = nil
+	if sub.CreatedAt.IsZero() {
+		sub.CreatedAt = time.Now()
+	}
+
+	raw, err := json.Marshal(toStored(sub))
+	if err != nil {
+		return fmt.Errorf("marshal subscription: %w", err)
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.HSet(ctx, s.userKey(sub.UserID), sub.Endpoint, raw)
+	pipe.SAdd(ctx, s.indexKey(), sub.UserID)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// ListByUser returns all subscriptions registered for userID.
+func (s *RedisStore) ListByUser(ctx context.Context, userID string) ([]Subscription, error) {
+	entries, err := s.client.HGetAll(ctx, s.userKey(userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	return decodeEntries(entries)
+}
+
+// ListAll returns every subscription across every user, used by the
+// periodic recheck sweep.
+func (s *RedisStore) ListAll(ctx context.Context) ([]Subscription, error) {
+	userIDs, err := s.client.SMembers(ctx, s.indexKey()).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var all []Subscription
+	for _, userID := range userIDs {
+		subs, err := s.ListByUser(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("list user %s: %w", userID, err)
+		}
+		all = append(all, subs...)
+	}
+	return all, nil
+}
+
+// MarkExpired flags the subscription with the given endpoint as expired
+// without deleting it, starting the grace-period clock.
+func (s *RedisStore) MarkExpired(ctx context.Context, endpoint string, at time.Time) error {
+	userIDs, err := s.client.SMembers(ctx, s.indexKey()).Result()
+	if err != nil {
+		return err
+	}
+
+	for _, userID := range userIDs {
+		raw, err := s.client.HGet(ctx, s.userKey(userID), endpoint).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		var stored storedSubscription
+		if err := json.Unmarshal([]byte(raw), &stored); err != nil {
+			return fmt.Errorf("unmarshal subscription: %w", err)
+		}
+
+		expiredAt := at
+		stored.ExpiredAt = &expiredAt
+
+		updated, err := json.Marshal(stored)
+		if err != nil {
+			return err
+		}
+		return s.client.HSet(ctx, s.userKey(userID), endpoint, updated).Err()
+	}
+
+	return nil
+}
+
+// DeleteExpiredBefore removes subscriptions that were marked expired
+// before cutoff, returning the number removed.
+func (s *RedisStore) DeleteExpiredBefore(ctx context.Context, cutoff time.Time) (int, error) {
+	userIDs, err := s.client.SMembers(ctx, s.indexKey()).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, userID := range userIDs {
+		entries, err := s.client.HGetAll(ctx, s.userKey(userID)).Result()
+		if err != nil {
+			return removed, err
+		}
+
+		for endpoint, raw := range entries {
+			var stored storedSubscription
+			if err := json.Unmarshal([]byte(raw), &stored); err != nil {
+				continue
+			}
+			if stored.ExpiredAt == nil || stored.ExpiredAt.After(cutoff) {
+				continue
+			}
+
+			if err := s.client.HDel(ctx, s.userKey(userID), endpoint).Err(); err != nil {
+				return removed, err
+			}
+			removed++
+		}
+
+		if remaining, err := s.client.HLen(ctx, s.userKey(userID)).Result(); err == nil && remaining == 0 {
+			s.client.SRem(ctx, s.indexKey(), userID)
+		}
+	}
+
+	return removed, nil
+}
+
+func decodeEntries(entries map[string]string) ([]Subscription, error) {
+	subs := make([]Subscription, 0, len(entries))
+	for _, raw := range entries {
+		var stored storedSubscription
+		if err := json.Unmarshal([]byte(raw), &stored); err != nil {
+			return nil, fmt.Errorf("unmarshal subscription: %w", err)
+		}
+		subs = append(subs, fromStored(stored))
+	}
+	return subs, nil
+}
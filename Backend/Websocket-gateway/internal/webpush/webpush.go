@@ -0,0 +1,233 @@
+// Package webpush delivers Web Push notifications (RFC 8030) to users who
+// have no active WebSocket connection on any shard, using browser-registered
+// VAPID subscriptions as the delivery address.
+package webpush
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+
+	"github.com/yourcompany/websocket-gateway/internal/config"
+)
+
+var (
+	ErrNotConfigured    = errors.New("webpush: VAPID keys not configured")
+	ErrNoSubscriptions  = errors.New("webpush: user has no active subscriptions")
+)
+
+// Subscription is a single browser Web Push registration.
+type Subscription struct {
+	UserID    string
+	Endpoint  string
+	P256dh    string
+	Auth      string
+	CreatedAt time.Time
+
+	// ExpiredAt is set once the push service reports the endpoint as
+	// gone (404/410) and is cleared if the subscription is re-registered.
+	ExpiredAt *time.Time
+}
+
+// Store persists subscriptions across restarts. The Redis-backed
+// implementation lives in store_redis.go; tests may supply an in-memory one.
+type Store interface {
+	Save(ctx context.Context, sub Subscription) error
+	ListByUser(ctx context.Context, userID string) ([]Subscription, error)
+	ListAll(ctx context.Context) ([]Subscription, error)
+	MarkExpired(ctx context.Context, endpoint string, at time.Time) error
+	DeleteExpiredBefore(ctx context.Context, cutoff time.Time) (int, error)
+}
+
+var (
+	sentTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "webpush_sent_total",
+		Help: "Total number of Web Push notifications successfully sent",
+	})
+	failuresTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "webpush_failures_total",
+		Help: "Total number of Web Push send failures by reason",
+	}, []string{"reason"})
+	subscriptionExpiredTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "webpush_subscription_expired_total",
+		Help: "Total number of subscriptions marked expired after a 404/410 response",
+	})
+)
+
+// Manager registers subscriptions and delivers payload-limited push
+// notifications on behalf of the connection.Manager's offline fallback.
+type Manager struct {
+	store  Store
+	client *http.Client
+	logger *zap.Logger
+
+	vapidPublicKey  string
+	vapidPrivateKey string
+	vapidSubject    string
+	maxPayloadSize  int
+	sendTimeout     time.Duration
+	gracePeriod     time.Duration
+	recheckInterval time.Duration
+}
+
+// NewManager creates a Web Push manager backed by store. It returns
+// ErrNotConfigured if cfg.WebPush.Enabled is false so callers can skip
+// wiring the fallback entirely.
+func NewManager(cfg *config.Config, store Store, logger *zap.Logger) (*Manager, error) {
+	if !cfg.WebPush.Enabled {
+		return nil, ErrNotConfigured
+	}
+	if cfg.WebPush.VAPIDPublicKey == "" || cfg.WebPush.VAPIDPrivateKey == "" {
+		return nil, ErrNotConfigured
+	}
+
+	return &Manager{
+		store:           store,
+		client:          &http.Client{Timeout: cfg.WebPush.SendTimeout},
+		logger:          logger,
+		vapidPublicKey:  cfg.WebPush.VAPIDPublicKey,
+		vapidPrivateKey: cfg.WebPush.VAPIDPrivateKey,
+		vapidSubject:    cfg.WebPush.VAPIDSubject,
+		maxPayloadSize:  cfg.WebPush.MaxPayloadSize,
+		sendTimeout:     cfg.WebPush.SendTimeout,
+		gracePeriod:     cfg.WebPush.ExpiredGracePeriod,
+		recheckInterval: cfg.WebPush.RecheckInterval,
+	}, nil
+}
+
+// RegisterSubscription stores a new (or re-activates an existing) Web Push
+// subscription received over TypeSubscribePush.
+func (m *Manager) RegisterSubscription(ctx context.Context, userID, endpoint, p256dh, auth string) error {
+	return m.store.Save(ctx, Subscription{
+		UserID:    userID,
+		Endpoint:  endpoint,
+		P256dh:    p256dh,
+		Auth:      auth,
+		CreatedAt: time.Now(),
+	})
+}
+
+// SendPush implements connection.PushFallback. It delivers payload to every
+// subscription registered for userID, truncating to maxPayloadSize and
+// pruning subscriptions the push service reports as gone.
+func (m *Manager) SendPush(ctx context.Context, userID string, payload []byte) error {
+	subs, err := m.store.ListByUser(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("webpush: list subscriptions: %w", err)
+	}
+	if len(subs) == 0 {
+		return ErrNoSubscriptions
+	}
+
+	if len(payload) > m.maxPayloadSize {
+		payload = payload[:m.maxPayloadSize]
+	}
+
+	var lastErr error
+	for _, sub := range subs {
+		if sub.ExpiredAt != nil {
+			continue
+		}
+
+		if err := m.deliver(ctx, sub, payload); err != nil {
+			lastErr = err
+			continue
+		}
+		sentTotal.Inc()
+	}
+
+	return lastErr
+}
+
+// deliver sends a single encrypted push message and handles the push
+// service's response, marking the subscription expired on 404/410.
+func (m *Manager) deliver(ctx context.Context, sub Subscription, payload []byte) error {
+	sendCtx, cancel := context.WithTimeout(ctx, m.sendTimeout)
+	defer cancel()
+
+	req, err := newPushRequest(sendCtx, sub, payload, m.vapidSubject, m.vapidPublicKey, m.vapidPrivateKey)
+	if err != nil {
+		failuresTotal.WithLabelValues("build_request").Inc()
+		return fmt.Errorf("webpush: build request: %w", err)
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		failuresTotal.WithLabelValues("transport").Inc()
+		return fmt.Errorf("webpush: send: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		failuresTotal.WithLabelValues("expired").Inc()
+		subscriptionExpiredTotal.Inc()
+		if err := m.store.MarkExpired(ctx, sub.Endpoint, time.Now()); err != nil {
+			m.logger.Warn("failed to mark subscription expired",
+				zap.String("user_id", sub.UserID), zap.Error(err))
+		}
+		return fmt.Errorf("webpush: subscription gone (%d)", resp.StatusCode)
+	case resp.StatusCode >= 300:
+		failuresTotal.WithLabelValues("push_service_error").Inc()
+		return fmt.Errorf("webpush: push service returned %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// StartPruning periodically deletes subscriptions that have been expired
+// for longer than the configured grace period.
+func (m *Manager) StartPruning(ctx context.Context) {
+	ticker := time.NewTicker(m.gracePeriod / 10)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cutoff := time.Now().Add(-m.gracePeriod)
+			removed, err := m.store.DeleteExpiredBefore(ctx, cutoff)
+			if err != nil {
+				m.logger.Warn("webpush subscription prune failed", zap.Error(err))
+				continue
+			}
+			if removed > 0 {
+				m.logger.Info("pruned expired webpush subscriptions", zap.Int("count", removed))
+			}
+		}
+	}
+}
+
+// StartRecheck periodically re-validates all stored subscriptions with a
+// zero-payload request so stale endpoints are caught even for users who
+// haven't received a message since they went stale.
+func (m *Manager) StartRecheck(ctx context.Context) {
+	ticker := time.NewTicker(m.recheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			subs, err := m.store.ListAll(ctx)
+			if err != nil {
+				m.logger.Warn("webpush recheck: list all failed", zap.Error(err))
+				continue
+			}
+			for _, sub := range subs {
+				if sub.ExpiredAt != nil {
+					continue
+				}
+				_ = m.deliver(ctx, sub, nil)
+			}
+		}
+	}
+}
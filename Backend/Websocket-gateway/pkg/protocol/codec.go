@@ -0,0 +1,104 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Protocol names negotiated over Sec-WebSocket-Protocol during the
+// WebSocket handshake. SupportedProtocols is in server preference
+// order: when a client advertises more than one, the first mutual
+// match wins.
+const (
+	ProtocolJSON    = "json.v1"
+	ProtocolMsgpack = "msgpack.v1"
+	ProtocolCBOR    = "cbor.v1"
+)
+
+var SupportedProtocols = []string{ProtocolMsgpack, ProtocolCBOR, ProtocolJSON}
+
+// Codec marshals and unmarshals protocol messages to and from a
+// particular wire encoding. JSON remains the canonical in-process
+// representation (backlog storage, coalescing keys, and every handler
+// that doesn't touch the wire directly all still speak it); a Codec is
+// only consulted at the edge, transcoding to and from whatever a given
+// client negotiated.
+type Codec interface {
+	Name() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string                          { return ProtocolJSON }
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)  { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(d []byte, v interface{}) error { return json.Unmarshal(d, v) }
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string { return ProtocolMsgpack }
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json") // reuse the existing `json:"..."` struct tags
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+type cborCodec struct{}
+
+func (cborCodec) Name() string                           { return ProtocolCBOR }
+func (cborCodec) Marshal(v interface{}) ([]byte, error)  { return cbor.Marshal(v) }
+func (cborCodec) Unmarshal(d []byte, v interface{}) error { return cbor.Unmarshal(d, v) }
+
+// JSON, Msgpack and CBOR are the gateway's three Codec implementations.
+// Stateless, so a single instance of each is shared by every client.
+var (
+	JSON    Codec = jsonCodec{}
+	Msgpack Codec = msgpackCodec{}
+	CBOR    Codec = cborCodec{}
+)
+
+// CodecByProtocol returns the Codec for a negotiated Sec-WebSocket-Protocol
+// value, or ok=false if it isn't one the gateway understands.
+func CodecByProtocol(name string) (Codec, bool) {
+	switch name {
+	case ProtocolJSON:
+		return JSON, true
+	case ProtocolMsgpack:
+		return Msgpack, true
+	case ProtocolCBOR:
+		return CBOR, true
+	default:
+		return nil, false
+	}
+}
+
+// Transcode re-encodes raw into to's wire format, decoding it as from
+// first. A no-op (returns raw unchanged) when from and to are the same
+// codec, which keeps the common JSON->JSON case allocation-free.
+func Transcode(raw []byte, from, to Codec) ([]byte, error) {
+	if from.Name() == to.Name() {
+		return raw, nil
+	}
+
+	msg, err := ParseMessageWithCodec(from, raw)
+	if err != nil {
+		return nil, fmt.Errorf("transcode %s->%s: %w", from.Name(), to.Name(), err)
+	}
+	return to.Marshal(msg)
+}
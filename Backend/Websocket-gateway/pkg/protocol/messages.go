@@ -1,7 +1,6 @@
 package protocol
 
 import (
-	"encoding/json"
 	"fmt"
 	"time"
 
@@ -18,129 +17,162 @@ const (
 	TypeACK           = "ack"
 	TypeError         = "error"
 	TypeHeartbeat     = "heartbeat"
+	TypeSubscribePush = "subscribe_push"
 )
 
 // BaseMessage is the common structure for all messages
 type BaseMessage struct {
-	Type      string    `json:"type"`
-	MessageID string    `json:"message_id,omitempty"`
-	Timestamp int64     `json:"timestamp"`
+	Type      string    `json:"type" cbor:"type"`
+	MessageID string    `json:"message_id,omitempty" cbor:"message_id,omitempty"`
+	Timestamp int64     `json:"timestamp" cbor:"timestamp"`
 }
 
 // AuthMessage for authentication
 type AuthMessage struct {
 	BaseMessage
-	Token string `json:"token"`
+	Token string `json:"token" cbor:"token"`
+
+	// LastMessageID is the sequence number of the last message this
+	// device successfully processed. When set, the gateway replays any
+	// backlog messages with a higher sequence after authentication
+	// succeeds, so a reconnecting client doesn't miss messages sent
+	// while it was offline.
+	LastMessageID *uint64 `json:"last_message_id,omitempty" cbor:"last_message_id,omitempty"`
 }
 
 // TextMessage for direct messaging
 type TextMessage struct {
 	BaseMessage
-	From    string          `json:"from"`
-	To      string          `json:"to"`
-	Payload TextPayload     `json:"payload"`
+	From    string          `json:"from" cbor:"from"`
+	To      string          `json:"to" cbor:"to"`
+	Payload TextPayload     `json:"payload" cbor:"payload"`
 }
 
 type TextPayload struct {
-	Text      string            `json:"text"`
-	MediaURL  string            `json:"media_url,omitempty"`
-	Metadata  map[string]string `json:"metadata,omitempty"`
-	ReplyTo   string            `json:"reply_to,omitempty"`
+	Text      string            `json:"text" cbor:"text"`
+	MediaURL  string            `json:"media_url,omitempty" cbor:"media_url,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty" cbor:"metadata,omitempty"`
+	ReplyTo   string            `json:"reply_to,omitempty" cbor:"reply_to,omitempty"`
 }
 
 // GroupMessage for group chats
 type GroupMessage struct {
 	BaseMessage
-	From      string          `json:"from"`
-	GroupID   string          `json:"group_id"`
-	Payload   TextPayload     `json:"payload"`
+	From      string          `json:"from" cbor:"from"`
+	GroupID   string          `json:"group_id" cbor:"group_id"`
+	Payload   TextPayload     `json:"payload" cbor:"payload"`
 }
 
 // TypingIndicator for real-time typing events
 type TypingIndicator struct {
 	BaseMessage
-	UserID    string `json:"user_id"`
-	ChatID    string `json:"chat_id"`
-	IsTyping  bool   `json:"is_typing"`
+	UserID    string `json:"user_id" cbor:"user_id"`
+	ChatID    string `json:"chat_id" cbor:"chat_id"`
+	IsTyping  bool   `json:"is_typing" cbor:"is_typing"`
 }
 
 // PresenceUpdate for online/offline status
 type PresenceUpdate struct {
 	BaseMessage
-	UserID    string    `json:"user_id"`
-	Status    string    `json:"status"` // online, away, offline
-	LastSeen  int64     `json:"last_seen,omitempty"`
-	Device    string    `json:"device,omitempty"`
+	UserID    string    `json:"user_id" cbor:"user_id"`
+	Status    string    `json:"status" cbor:"status"` // online, away, offline
+	LastSeen  int64     `json:"last_seen,omitempty" cbor:"last_seen,omitempty"`
+	Device    string    `json:"device,omitempty" cbor:"device,omitempty"`
 }
 
 // Acknowledgement message
 type Acknowledgement struct {
 	BaseMessage
-	OriginalMessageID string `json:"original_message_id"`
-	Status            string `json:"status"` // delivered, read, failed
+	OriginalMessageID string `json:"original_message_id" cbor:"original_message_id"`
+	Status            string `json:"status" cbor:"status"` // delivered, read, failed
 }
 
 // ErrorMessage for error responses
 type ErrorMessage struct {
 	BaseMessage
-	Code    string `json:"code"`
-	Message string `json:"message"`
-	Details string `json:"details,omitempty"`
+	Code    string `json:"code" cbor:"code"`
+	Message string `json:"message" cbor:"message"`
+	Details string `json:"details,omitempty" cbor:"details,omitempty"`
 }
 
 // Heartbeat for keepalive
 type Heartbeat struct {
 	BaseMessage
-	Sequence int64 `json:"sequence"`
+	Sequence int64 `json:"sequence" cbor:"sequence"`
 }
 
-// ParseMessage parses raw JSON into appropriate message type
+// SubscribePushMessage registers a Web Push subscription for the
+// authenticated client so it can receive notifications while offline.
+type SubscribePushMessage struct {
+	BaseMessage
+	Endpoint string `json:"endpoint" cbor:"endpoint"`
+	P256dh   string `json:"p256dh" cbor:"p256dh"`
+	Auth     string `json:"auth" cbor:"auth"`
+}
+
+// ParseMessage parses raw JSON into the appropriate message type. It's a
+// thin wrapper around ParseMessageWithCodec(JSON, raw) kept for the many
+// call sites that only ever deal in the canonical JSON representation.
 func ParseMessage(raw []byte) (interface{}, error) {
+	return ParseMessageWithCodec(JSON, raw)
+}
+
+// ParseMessageWithCodec decodes raw with codec into the appropriate
+// message type, based on its "type" field. Used by Transcode to convert
+// between wire encodings, and directly by callers that already know a
+// message arrived in a non-JSON codec.
+func ParseMessageWithCodec(codec Codec, raw []byte) (interface{}, error) {
 	var base BaseMessage
-	if err := json.Unmarshal(raw, &base); err != nil {
+	if err := codec.Unmarshal(raw, &base); err != nil {
 		return nil, fmt.Errorf("invalid message format: %w", err)
 	}
 
 	switch base.Type {
 	case TypeAuth:
 		var msg AuthMessage
-		if err := json.Unmarshal(raw, &msg); err != nil {
+		if err := codec.Unmarshal(raw, &msg); err != nil {
 			return nil, err
 		}
 		return msg, nil
 	case TypeMessage:
 		var msg TextMessage
-		if err := json.Unmarshal(raw, &msg); err != nil {
+		if err := codec.Unmarshal(raw, &msg); err != nil {
 			return nil, err
 		}
 		return msg, nil
 	case TypeGroupMessage:
 		var msg GroupMessage
-		if err := json.Unmarshal(raw, &msg); err != nil {
+		if err := codec.Unmarshal(raw, &msg); err != nil {
 			return nil, err
 		}
 		return msg, nil
 	case TypeTyping:
 		var msg TypingIndicator
-		if err := json.Unmarshal(raw, &msg); err != nil {
+		if err := codec.Unmarshal(raw, &msg); err != nil {
 			return nil, err
 		}
 		return msg, nil
 	case TypePresence:
 		var msg PresenceUpdate
-		if err := json.Unmarshal(raw, &msg); err != nil {
+		if err := codec.Unmarshal(raw, &msg); err != nil {
 			return nil, err
 		}
 		return msg, nil
 	case TypeACK:
 		var msg Acknowledgement
-		if err := json.Unmarshal(raw, &msg); err != nil {
+		if err := codec.Unmarshal(raw, &msg); err != nil {
 			return nil, err
 		}
 		return msg, nil
 	case TypeHeartbeat:
 		var msg Heartbeat
-		if err := json.Unmarshal(raw, &msg); err != nil {
+		if err := codec.Unmarshal(raw, &msg); err != nil {
+			return nil, err
+		}
+		return msg, nil
+	case TypeSubscribePush:
+		var msg SubscribePushMessage
+		if err := codec.Unmarshal(raw, &msg); err != nil {
 			return nil, err
 		}
 		return msg, nil